@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/validator"
+	"github.com/go-chi/chi/v5"
+	"github.com/patrickmn/go-cache"
+)
+
+func (app *application) getCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
+
+	if _, ok := catalogExports[kind]; !ok {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	makeID := int32(app.readInt(qs, "make_id", 0, v))
+	modelID := int32(app.readInt(qs, "model_id", 0, v))
+	genID := int32(app.readInt(qs, "gen_id", 0, v))
+	cityID := int32(app.readInt(qs, "city_id", 0, v))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rows, err := app.catalogRows(kind)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	switch rows := rows.(type) {
+	case []*data.Model:
+		rows = filterRows(rows, func(m *data.Model) bool {
+			return makeID == 0 || m.MakeID == makeID
+		})
+		err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{kind: rows}, nil)
+	case []*data.Generation:
+		rows = filterRows(rows, func(g *data.Generation) bool {
+			return modelID == 0 || g.ModelID == modelID
+		})
+		err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{kind: rows}, nil)
+	case []*data.Version:
+		rows = filterRows(rows, func(ver *data.Version) bool {
+			return (modelID == 0 || ver.ModelID == modelID) && (genID == 0 || ver.GenID == genID)
+		})
+		err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{kind: rows}, nil)
+	case []*data.Area:
+		rows = filterRows(rows, func(a *data.Area) bool {
+			return cityID == 0 || a.CityID == cityID
+		})
+		err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{kind: rows}, nil)
+	default:
+		err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{kind: rows}, nil)
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getCatalogChangesHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	since := int64(app.readInt(r.URL.Query(), "since", 0, v))
+	v.Check(since >= 0, "since", "must not be negative")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	changes, err := app.models.Data.GetChanges(since)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSONWithETag(w, r, http.StatusOK, envelope{"changes": changes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// catalogRows returns every row of a catalog kind, reading through app.cache.
+func (app *application) catalogRows(kind string) (any, error) {
+	cacheKey := "catalog:" + kind
+
+	if rows, found := app.cache.Get(cacheKey); found {
+		return rows, nil
+	}
+
+	rows, err := catalogExports[kind].fetch(&app.models.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	app.cache.Set(cacheKey, rows, cache.DefaultExpiration)
+
+	return rows, nil
+}
+
+func filterRows[T any](rows []T, keep func(T) bool) []T {
+	filtered := []T{}
+	for _, row := range rows {
+		if keep(row) {
+			filtered = append(filtered, row)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/validator"
+	"github.com/go-chi/chi/v5"
+)
+
+func (app *application) createMakeHandler(w http.ResponseWriter, r *http.Request) {
+	record := &data.MakeRecord{Published: true}
+	saveCatalogRecord(app, w, r, "makes", http.StatusCreated, record, app.validateMakeRecord, app.models.Data.InsertMake)
+}
+
+func (app *application) updateMakeHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	record, err := app.models.Data.GetMakeRecord(int32(id))
+	if err != nil {
+		app.catalogLookupError(w, r, err)
+		return
+	}
+
+	saveCatalogRecord(app, w, r, "makes", http.StatusOK, record, app.validateMakeRecord, func(record *data.MakeRecord) error {
+		record.ID = int32(id)
+		return app.models.Data.UpdateMake(record)
+	})
+}
+
+func (app *application) createModelHandler(w http.ResponseWriter, r *http.Request) {
+	model := &data.ModelRecord{Published: true}
+	saveCatalogRecord(app, w, r, "models", http.StatusCreated, model, app.validateModelRecord, app.models.Data.InsertModel)
+}
+
+func (app *application) updateModelHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	model, err := app.models.Data.GetModelRecord(int32(id))
+	if err != nil {
+		app.catalogLookupError(w, r, err)
+		return
+	}
+
+	saveCatalogRecord(app, w, r, "models", http.StatusOK, model, app.validateModelRecord, func(model *data.ModelRecord) error {
+		model.ID = int32(id)
+		return app.models.Data.UpdateModel(model)
+	})
+}
+
+func (app *application) createGenerationHandler(w http.ResponseWriter, r *http.Request) {
+	generation := &data.GenerationRecord{Published: true}
+	saveCatalogRecord(app, w, r, "generations", http.StatusCreated, generation, app.validateGenerationRecord, app.models.Data.InsertGeneration)
+}
+
+func (app *application) updateGenerationHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	generation, err := app.models.Data.GetGenerationRecord(int32(id))
+	if err != nil {
+		app.catalogLookupError(w, r, err)
+		return
+	}
+
+	saveCatalogRecord(app, w, r, "generations", http.StatusOK, generation, app.validateGenerationRecord, func(generation *data.GenerationRecord) error {
+		generation.ID = int32(id)
+		return app.models.Data.UpdateGeneration(generation)
+	})
+}
+
+func (app *application) createVersionHandler(w http.ResponseWriter, r *http.Request) {
+	version := &data.VersionRecord{Published: true}
+	saveCatalogRecord(app, w, r, "versions", http.StatusCreated, version, app.validateVersionRecord, app.models.Data.InsertVersion)
+}
+
+func (app *application) updateVersionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	version, err := app.models.Data.GetVersionRecord(int32(id))
+	if err != nil {
+		app.catalogLookupError(w, r, err)
+		return
+	}
+
+	saveCatalogRecord(app, w, r, "versions", http.StatusOK, version, app.validateVersionRecord, func(version *data.VersionRecord) error {
+		version.ID = int32(id)
+		return app.models.Data.UpdateVersion(version)
+	})
+}
+
+func (app *application) publishCatalogRecordHandler(w http.ResponseWriter, r *http.Request) {
+	app.setCatalogPublished(w, r, true)
+}
+
+func (app *application) unpublishCatalogRecordHandler(w http.ResponseWriter, r *http.Request) {
+	app.setCatalogPublished(w, r, false)
+}
+
+func (app *application) setCatalogPublished(w http.ResponseWriter, r *http.Request, published bool) {
+	kind := chi.URLParam(r, "kind")
+
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Data.SetPublished(kind, int32(id), published)
+	if err != nil {
+		app.catalogLookupError(w, r, err)
+		return
+	}
+
+	app.refreshCatalog(kind)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"id": id, "published": published}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// saveCatalogRecord decodes the request body over record, validates it, saves it
+// with save and refreshes the cached catalog for kind.
+func saveCatalogRecord[T any](app *application, w http.ResponseWriter, r *http.Request, kind string, status int, record *T,
+	validate func(*validator.Validator, *T) error, save func(*T) error) {
+
+	err := app.readJSON(w, r, record)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	err = validate(v, record)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = save(record)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("url_slug", "a record with this url slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.refreshCatalog(kind)
+
+	err = app.writeJSON(w, status, envelope{"record": record}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) validateMakeRecord(v *validator.Validator, record *data.MakeRecord) error {
+	data.ValidateMakeRecord(v, record)
+	return nil
+}
+
+func (app *application) validateModelRecord(v *validator.Validator, model *data.ModelRecord) error {
+	if data.ValidateModelRecord(v, model); !v.Valid() {
+		return nil
+	}
+
+	_, err := app.models.Data.GetMakeRecord(model.MakeID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		v.AddError("make_id", "must reference an existing make")
+		return nil
+	}
+	return err
+}
+
+func (app *application) validateGenerationRecord(v *validator.Validator, generation *data.GenerationRecord) error {
+	if data.ValidateGenerationRecord(v, generation); !v.Valid() {
+		return nil
+	}
+
+	_, err := app.models.Data.GetModelRecord(generation.ModelID)
+	if errors.Is(err, data.ErrRecordNotFound) {
+		v.AddError("model_id", "must reference an existing model")
+		return nil
+	}
+	return err
+}
+
+func (app *application) validateVersionRecord(v *validator.Validator, version *data.VersionRecord) error {
+	if data.ValidateVersionRecord(v, version); !v.Valid() {
+		return nil
+	}
+
+	generation, err := app.models.Data.GetGenerationRecord(version.GenID)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			v.AddError("gen_id", "must reference an existing generation")
+			return nil
+		}
+		return err
+	}
+
+	v.Check(generation.ModelID == version.ModelID, "gen_id", "must belong to the version's model")
+	return nil
+}
+
+func (app *application) importCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("body must be a multipart form of at most 32 MB"))
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		app.badRequestResponse(w, r, errors.New("a file must be provided"))
+		return
+	}
+	defer file.Close()
+
+	v := validator.New()
+
+	dryRun := app.readBool(r.Form, "dry_run", v)
+	kind := r.FormValue("kind")
+	isCSV := strings.HasSuffix(strings.ToLower(header.Filename), ".csv")
+
+	v.Check(!isCSV || kind != "", "kind", "must be provided for csv files")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	var batch data.ImportBatch
+	if isCSV {
+		batch, err = data.ParseImportCSV(kind, file)
+	} else {
+		batch, err = data.ParseImportJSON(file)
+	}
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if data.ValidateImportBatch(v, batch); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	report, err := app.models.Data.Import(batch, dryRun != nil && *dryRun)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrImportParentNotFound), errors.Is(err, data.ErrImportGenerationMismatch):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !report.DryRun {
+		for kind := range batch {
+			app.refreshCatalog(kind)
+		}
+	}
+
+	var diff strings.Builder
+	err = report.WriteDiff(&diff)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"report": report, "diff": diff.String()}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) catalogLookupError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshCatalog drops the cached rows for kind and regenerates its export file in
+// the background.
+func (app *application) refreshCatalog(kind string) {
+	app.cache.Delete("catalog:" + kind)
+
+	export, ok := catalogExports[kind]
+	if !ok {
+		return
+	}
+
+	app.background(func() {
+		rows, err := export.fetch(&app.models.Data)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"catalog": kind})
+			return
+		}
+
+		err = writeCatalogFile(export.file, rows)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"catalog": kind})
+		}
+	})
+}
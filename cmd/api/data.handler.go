@@ -3,379 +3,147 @@ package main
 import (
 	"encoding/json"
 	"net/http"
-	"os"
-)
-
-func (app *application) updateMakes(w http.ResponseWriter, r *http.Request) {
-	makes, err := app.models.Data.GetMakes()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize makes data to JSON format
-	jsonData, err := json.MarshalIndent(makes, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/makes.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Data updated successfully"))
-}
-
-func (app *application) updateModels(w http.ResponseWriter, r *http.Request) {
-	models, err := app.models.Data.GetModels()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize makes data to JSON format
-	jsonData, err := json.MarshalIndent(models, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/models.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Data updated successfully"))
-}
-
-func (app *application) updateGenerations(w http.ResponseWriter, r *http.Request) {
-	generations, err := app.models.Data.GetGenerations()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize generations data to JSON format
-	jsonData, err := json.MarshalIndent(generations, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/generations.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Generations data updated successfully"))
-}
-
-func (app *application) updateVersions(w http.ResponseWriter, r *http.Request) {
-	versions, err := app.models.Data.GetVersions()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize versions data to JSON format
-	jsonData, err := json.MarshalIndent(versions, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/versions.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Versions data updated successfully"))
-}
-
-func (app *application) updateColors(w http.ResponseWriter, r *http.Request) {
-	colors, err := app.models.Data.GetColors()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize colors data to JSON format
-	jsonData, err := json.MarshalIndent(colors, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+	"path/filepath"
 
-	// Save the JSON data to a file
-	filePath := "./data/colors.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
+	"ghostprotocols.pk/internal/data"
+	"github.com/go-chi/chi/v5"
+)
 
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+const catalogDir = "./data"
 
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Colors data updated successfully"))
+// catalogExport describes one of the JSON files in ./data that the client apps
+// ship with, and how to pull its contents out of a catalog snapshot.
+type catalogExport struct {
+	file    string
+	fetch   func(m *data.DataModel) (any, error)
+	extract func(c *data.Catalog) any
 }
 
-func (app *application) updateTransmissions(w http.ResponseWriter, r *http.Request) {
-	transmissions, err := app.models.Data.GetTransmissions()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize transmissions data to JSON format
-	jsonData, err := json.MarshalIndent(transmissions, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/transmissions.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Transmissions data updated successfully"))
+var catalogExports = map[string]catalogExport{
+	"makes": {
+		file:    "makes.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetMakes() },
+		extract: func(c *data.Catalog) any { return c.Makes },
+	},
+	"models": {
+		file:    "models.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetModels() },
+		extract: func(c *data.Catalog) any { return c.Models },
+	},
+	"generations": {
+		file:    "generations.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetGenerations() },
+		extract: func(c *data.Catalog) any { return c.Generations },
+	},
+	"versions": {
+		file:    "versions.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetVersions() },
+		extract: func(c *data.Catalog) any { return c.Versions },
+	},
+	"colors": {
+		file:    "colors.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetColors() },
+		extract: func(c *data.Catalog) any { return c.Colors },
+	},
+	"transmissions": {
+		file:    "transmissions.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetTransmissions() },
+		extract: func(c *data.Catalog) any { return c.Transmissions },
+	},
+	"body_types": {
+		file:    "body_types.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetBodyTypes() },
+		extract: func(c *data.Catalog) any { return c.BodyTypes },
+	},
+	"fuel_types": {
+		file:    "fuel_types.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetFuelTypes() },
+		extract: func(c *data.Catalog) any { return c.FuelTypes },
+	},
+	"cities": {
+		file:    "cities.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetCities() },
+		extract: func(c *data.Catalog) any { return c.Cities },
+	},
+	"areas": {
+		file:    "areas.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetAreas() },
+		extract: func(c *data.Catalog) any { return c.Areas },
+	},
+	"registrations": {
+		file:    "registrations.json",
+		fetch:   func(m *data.DataModel) (any, error) { return m.GetRegistrations() },
+		extract: func(c *data.Catalog) any { return c.Registrations },
+	},
 }
 
-func (app *application) updateBodyTypes(w http.ResponseWriter, r *http.Request) {
-	bodyTypes, err := app.models.Data.GetBodyTypes()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize body types data to JSON format
-	jsonData, err := json.MarshalIndent(bodyTypes, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/body_types.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
+func (app *application) updateCatalogHandler(w http.ResponseWriter, r *http.Request) {
+	kind := chi.URLParam(r, "kind")
 
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+	if kind == "all" {
+		app.updateAllCatalogsHandler(w, r)
 		return
 	}
 
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Body types data updated successfully"))
-}
-
-func (app *application) updateFuelTypes(w http.ResponseWriter, r *http.Request) {
-	fuelTypes, err := app.models.Data.GetFuelTypes()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
+	export, ok := catalogExports[kind]
+	if !ok {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	// Serialize fuel types data to JSON format
-	jsonData, err := json.MarshalIndent(fuelTypes, "", "  ")
+	rows, err := export.fetch(&app.models.Data)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Save the JSON data to a file
-	filePath := "./data/fuel_types.json"
-	file, err := os.Create(filePath)
+	err = writeCatalogFile(export.file, rows)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
-	defer file.Close()
 
-	_, err = file.Write(jsonData)
+	err = app.writeJSON(w, http.StatusOK, envelope{"updated": []string{export.file}}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Fuel types data updated successfully"))
 }
 
-func (app *application) updateCities(w http.ResponseWriter, r *http.Request) {
-	fuelTypes, err := app.models.Data.GetCities()
+// updateAllCatalogsHandler regenerates every catalog file from a single database
+// snapshot so that, for example, versions.json never references a model missing
+// from models.json.
+func (app *application) updateAllCatalogsHandler(w http.ResponseWriter, r *http.Request) {
+	catalog, err := app.models.Data.GetCatalog()
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Serialize fuel types data to JSON format
-	jsonData, err := json.MarshalIndent(fuelTypes, "", "  ")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
+	updated := []string{}
 
-	// Save the JSON data to a file
-	filePath := "./data/cities.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
+	for _, export := range catalogExports {
+		err = writeCatalogFile(export.file, export.extract(catalog))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		updated = append(updated, export.file)
 	}
 
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Cities data updated successfully"))
-}
-
-func (app *application) updateAreas(w http.ResponseWriter, r *http.Request) {
-	fuelTypes, err := app.models.Data.GetAreas()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize fuel types data to JSON format
-	jsonData, err := json.MarshalIndent(fuelTypes, "", "  ")
+	err = app.writeJSON(w, http.StatusOK, envelope{"updated": updated}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
-
-	// Save the JSON data to a file
-	filePath := "./data/areas.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Areas data updated successfully"))
 }
 
-func (app *application) updateRegistration(w http.ResponseWriter, r *http.Request) {
-	fuelTypes, err := app.models.Data.GetRegistrations()
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Serialize fuel types data to JSON format
-	jsonData, err := json.MarshalIndent(fuelTypes, "", "  ")
+// writeCatalogFile serializes rows into the named file in ./data, atomically so
+// that readers see either the old file or the new one and never a truncated one.
+func writeCatalogFile(name string, rows any) error {
+	jsonData, err := json.MarshalIndent(rows, "", "  ")
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-
-	// Save the JSON data to a file
-	filePath := "./data/registrations.json"
-	file, err := os.Create(filePath)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
-	}
-	defer file.Close()
-
-	_, err = file.Write(jsonData)
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+		return err
 	}
 
-	// Optionally, send a response back to the client
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("Registrations data updated successfully"))
+	return writeFileAtomic(filepath.Join(catalogDir, name), jsonData)
 }
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/imaging"
+	"ghostprotocols.pk/internal/validator"
+)
+
+// maxGalleryImages matches the limit ValidateListing puts on a listing gallery.
+const maxGalleryImages = 20
+
+// saveGalleryBatchHandler accepts up to maxGalleryImages images in the "images"
+// field of a multipart form and queues them for processing. The returned images
+// are ordered as the files were sent.
+func (app *application) saveGalleryBatchHandler(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxGalleryImages*maxUploadBytes+1<<20)
+
+	err := r.ParseMultipartForm(32 << 20)
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("body must be a multipart form of at most %d images of %d MB", maxGalleryImages, maxUploadBytes>>20))
+		return
+	}
+
+	files := r.MultipartForm.File["images"]
+
+	v := validator.New()
+
+	v.Check(len(files) > 0, "images", "must contain at least one image")
+	v.Check(len(files) <= maxGalleryImages, "images", fmt.Sprintf("must not contain more than %d images", maxGalleryImages))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Check every file before queueing any so a bad file rejects the whole batch.
+	bodies := make([][]byte, len(files))
+
+	for i, header := range files {
+		key := fmt.Sprintf("images[%d]", i)
+
+		if header.Size > maxUploadBytes {
+			v.AddError(key, fmt.Sprintf("must not be larger than %d MB", maxUploadBytes>>20))
+			continue
+		}
+
+		file, err := header.Open()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		bodies[i], err = io.ReadAll(io.LimitReader(file, maxUploadBytes))
+		file.Close()
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = imaging.Check(bodies[i], app.maxUploadPixels())
+		switch {
+		case err == nil:
+		case errors.Is(err, imaging.ErrTooManyPixels):
+			v.AddError(key, fmt.Sprintf("must not be larger than %g megapixels", app.config.media.maxMegapixels))
+		case errors.Is(err, imaging.ErrUnsupportedFormat):
+			v.AddError(key, err.Error())
+		default:
+			v.AddError(key, "must be a readable image")
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	queued, err := app.queueGalleryUploads(app.contextGetUser(r).ID, bodies)
+	if err != nil {
+		switch {
+		case errors.Is(err, errImageQueueFull):
+			app.serverBusyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	uploads := make([]envelope, 0, len(queued))
+
+	for i, upload := range queued {
+		response := galleryUploadResponse(upload)
+		image := galleryImage(upload)
+		image.Order = int16(i)
+		response["image"] = image
+
+		uploads = append(uploads, response)
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"uploads": uploads}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateListingGalleryHandler replaces the gallery of a listing with the images
+// in the request, in order, optionally moving a cover image to the front. Every
+// image must already be in the gallery or be a processed upload of the seller.
+func (app *application) updateListingGalleryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	listing, err := app.models.Listings.GetForUpdate(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if listing.Status == data.ListingStatusRemoved {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if int64(listing.SellerID) != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Images []string `json:"images"`
+		Cover  *string  `json:"cover"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	images := input.Images
+
+	if input.Cover != nil {
+		v.Check(validator.PermittedValue(*input.Cover, input.Images...), "cover", "must be one of the images")
+
+		images = []string{*input.Cover}
+		for _, url := range input.Images {
+			if url != *input.Cover {
+				images = append(images, url)
+			}
+		}
+	}
+
+	gallery, err := app.resolveGallery(v, "images", listing, images)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	listing.Gallery = gallery
+
+	err = app.models.Listings.Update(listing)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		app.flagDuplicatePhotos(int64(listing.ID))
+		app.rerenderGallery(listing)
+	})
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"gallery": listing.Gallery}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// resolveGallery checks the gallery urls a seller sent for listing and looks up
+// the gallery entry for each, in order. Images already in the listing's gallery
+// are kept as they are, anything else must be a processed gallery upload of the
+// seller that no other listing has claimed. Problems are added to v under field.
+func (app *application) resolveGallery(v *validator.Validator, field string, listing *data.Listing, urls []string) ([]data.Image, error) {
+	v.Check(len(urls) > 0, field, "must contain at least one image")
+	v.Check(len(urls) <= maxGalleryImages, field, fmt.Sprintf("must not contain more than %d images", maxGalleryImages))
+	v.Check(validator.Unique(urls), field, "must not contain duplicate images")
+	if !v.Valid() {
+		return nil, nil
+	}
+
+	existing := make(map[string]data.Image, len(listing.Gallery))
+	for _, image := range listing.Gallery {
+		existing[image.Url] = image
+	}
+
+	var ids []string
+	for _, url := range urls {
+		if _, ok := existing[url]; !ok {
+			ids = append(ids, strings.TrimSuffix(url, ".webp"))
+		}
+	}
+
+	uploads := map[string]*data.MediaUpload{}
+
+	if len(ids) > 0 {
+		var err error
+
+		uploads, err = app.models.MediaUploads.GetGallery(int64(listing.SellerID), int64(listing.ID), ids)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	gallery := make([]data.Image, 0, len(urls))
+
+	for _, url := range urls {
+		if image, ok := existing[url]; ok {
+			gallery = append(gallery, image)
+			continue
+		}
+
+		upload, ok := uploads[strings.TrimSuffix(url, ".webp")]
+		switch {
+		case !ok:
+			v.AddError(field, fmt.Sprintf("%s is not an image uploaded by the seller", url))
+		case upload.Processing == data.ProcessingPending:
+			v.AddError(field, fmt.Sprintf("%s is still being processed", url))
+		case upload.Processing == data.ProcessingFailed:
+			v.AddError(field, fmt.Sprintf("%s could not be processed", url))
+		default:
+			gallery = append(gallery, galleryImage(upload))
+		}
+	}
+
+	for i := range gallery {
+		gallery[i].Order = int16(i)
+	}
+
+	return gallery, nil
+}
+
+// galleryURLs returns the urls of images, which is all a seller decides about the
+// images of a gallery.
+func galleryURLs(images []data.Image) []string {
+	urls := make([]string, len(images))
+	for i, image := range images {
+		urls[i] = image.Url
+	}
+	return urls
+}
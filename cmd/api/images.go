@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/imaging"
+	"ghostprotocols.pk/internal/validator"
+	"github.com/chai2010/webp"
+	"github.com/nfnt/resize"
+)
+
+// maxUploadBytes bounds the size of a single image upload.
+const maxUploadBytes = 10 << 20
+
+var errMissingImage = errors.New("an image file must be provided")
+
+// readUpload reads the file in the named field of a multipart form.
+func (app *application) readUpload(w http.ResponseWriter, r *http.Request, field string) ([]byte, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes+1<<20)
+
+	err := r.ParseMultipartForm(maxUploadBytes)
+	if err != nil {
+		return nil, fmt.Errorf("body must be a multipart form of at most %d MB", maxUploadBytes>>20)
+	}
+
+	file, _, err := r.FormFile(field)
+	if err != nil {
+		return nil, errMissingImage
+	}
+	defer file.Close()
+
+	return io.ReadAll(io.LimitReader(file, maxUploadBytes))
+}
+
+// readImageUpload reads the image in the named field of a multipart form and
+// decodes it with the format detected from its contents. Images with more pixels
+// than the configured limit are rejected before they are decoded.
+func (app *application) readImageUpload(w http.ResponseWriter, r *http.Request, field string) (image.Image, error) {
+	b, err := app.readUpload(w, r, field)
+	if err != nil {
+		return nil, err
+	}
+
+	return imaging.Decode(b, app.maxUploadPixels())
+}
+
+func (app *application) maxUploadPixels() int {
+	return int(app.config.media.maxMegapixels * 1e6)
+}
+
+func (app *application) imageUploadErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	v := validator.New()
+
+	switch {
+	case errors.Is(err, errMissingImage), errors.Is(err, imaging.ErrUnsupportedFormat):
+		v.AddError("image", err.Error())
+	case errors.Is(err, imaging.ErrTooManyPixels):
+		v.AddError("image", fmt.Sprintf("must not be larger than %g megapixels", app.config.media.maxMegapixels))
+	default:
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.failedValidationResponse(w, r, v.Errors)
+}
+
+// rendition is one of the sizes a gallery image is stored in. The full rendition
+// keeps the bare <uuid>.webp name so that existing gallery URLs stay valid.
+type rendition struct {
+	name    string
+	width   uint
+	quality float32
+}
+
+var galleryRenditions = []rendition{
+	{name: "thumb", width: 320, quality: 70},
+	{name: "card", width: 640, quality: 75},
+	{name: "full", width: 1280, quality: 82},
+}
+
+func (r rendition) filename(id string) string {
+	if r.name == "full" {
+		return id + ".webp"
+	}
+	return id + "_" + r.name + ".webp"
+}
+
+// saveGalleryRenditions writes every gallery rendition of img to the listings
+// prefix of the media store, watermarked with mark unless it is nil, and returns
+// the Image describing them.
+func (app *application) saveGalleryRenditions(ctx context.Context, img image.Image, id string, mark *imaging.Watermark) (*data.Image, error) {
+	result := &data.Image{}
+
+	for _, r := range galleryRenditions {
+		resized := resizeToWidth(img, r.width)
+		if mark != nil {
+			resized = mark.Apply(resized)
+		}
+
+		err := app.saveImageAsWebP(ctx, resized, "listings/"+r.filename(id), r.quality)
+		if err != nil {
+			return nil, err
+		}
+
+		switch r.name {
+		case "thumb":
+			result.ThumbUrl = r.filename(id)
+		case "card":
+			result.CardUrl = r.filename(id)
+		case "full":
+			result.Url = r.filename(id)
+			result.Width = resized.Bounds().Dx()
+			result.Height = resized.Bounds().Dy()
+		}
+	}
+
+	return result, nil
+}
+
+// originalKey is where the upright, metadata-free original of a gallery upload is
+// kept so that its renditions can be re-rendered with a different watermark. The
+// originals prefix is never served.
+func originalKey(id string) string {
+	return "originals/" + id + ".webp"
+}
+
+// watermarkFor returns the watermark for the gallery images of listing, or nil
+// when they should not be watermarked. Images not yet on a listing only get the
+// logo. Photos of listings we manage ourselves are left clean.
+func (app *application) watermarkFor(listing *data.Listing) *imaging.Watermark {
+	if listing != nil && listing.GpManaged {
+		return nil
+	}
+
+	mark := &imaging.Watermark{Logo: app.watermarkLogo, Opacity: 0.6}
+	if listing != nil && app.config.media.watermarkListingID {
+		mark.Label = fmt.Sprintf("#%d", listing.ID)
+	}
+
+	if mark.Logo == nil && mark.Label == "" {
+		return nil
+	}
+	return mark
+}
+
+// uploadKeys returns the media store keys of every file stored for upload.
+func uploadKeys(upload *data.MediaUpload) []string {
+	switch upload.Kind {
+	case data.UploadKindGallery:
+		keys := []string{originalKey(upload.ID)}
+		for _, r := range galleryRenditions {
+			keys = append(keys, "listings/"+r.filename(upload.ID))
+		}
+		return keys
+	case data.UploadKindProfile:
+		return []string{"user-profile/" + upload.ID + ".webp"}
+	default:
+		return nil
+	}
+}
+
+// galleryImage returns the gallery entry for a processed gallery upload.
+func galleryImage(upload *data.MediaUpload) data.Image {
+	result := data.Image{Width: upload.Width, Height: upload.Height}
+
+	for _, r := range galleryRenditions {
+		switch r.name {
+		case "thumb":
+			result.ThumbUrl = r.filename(upload.ID)
+		case "card":
+			result.CardUrl = r.filename(upload.ID)
+		case "full":
+			result.Url = r.filename(upload.ID)
+		}
+	}
+
+	return result
+}
+
+// resizeToWidth scales img down to width while maintaining its aspect ratio.
+// Images that are already narrower are returned unchanged.
+func resizeToWidth(img image.Image, width uint) image.Image {
+	if uint(img.Bounds().Dx()) <= width {
+		return img
+	}
+	return resize.Resize(width, 0, img, resize.Lanczos3)
+}
+
+// resizeToHeight scales img to height while maintaining its aspect ratio.
+func resizeToHeight(img image.Image, height uint) image.Image {
+	return resize.Resize(0, height, img, resize.Lanczos3)
+}
+
+// saveImageAsWebP encodes img as lossy WebP and stores it in the media store
+// under key.
+func (app *application) saveImageAsWebP(ctx context.Context, img image.Image, key string, quality float32) error {
+	var buf bytes.Buffer
+
+	err := webp.Encode(&buf, img, &webp.Options{Quality: quality})
+	if err != nil {
+		return fmt.Errorf("error encoding webp: %w", err)
+	}
+
+	err = app.media.Put(ctx, key, &buf, "image/webp")
+	if err != nil {
+		return fmt.Errorf("error storing image: %w", err)
+	}
+
+	return nil
+}
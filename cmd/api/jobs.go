@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"ghostprotocols.pk/internal/data"
+)
+
+// expireListingsJob periodically expires listings that have passed their expiry
+// date until the server shuts down.
+func (app *application) expireListingsJob() {
+	ticker := time.NewTicker(app.config.listings.expiryInterval)
+	defer ticker.Stop()
+
+	for {
+		app.expireListings()
+
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) expireListings() {
+	expired, err := app.models.Listings.ExpireDue()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "expire_listings"})
+		return
+	}
+
+	for _, listing := range expired {
+		app.notifyListingExpired(listing)
+	}
+
+	if len(expired) > 0 {
+		app.logger.PrintInfo("expired listings", map[string]string{
+			"job":   "expire_listings",
+			"count": strconv.Itoa(len(expired)),
+		})
+	}
+}
+
+// notifyListingExpired tells the seller their listing expired, by email if they
+// have an address and by SMS otherwise.
+func (app *application) notifyListingExpired(listing *data.ExpiredListing) {
+	props := map[string]string{
+		"listing_id": strconv.FormatInt(listing.ID, 10),
+		"seller_id":  strconv.FormatInt(listing.SellerID, 10),
+	}
+
+	var err error
+
+	switch {
+	case listing.SellerEmail != "":
+		err = app.mailer.Send(listing.SellerEmail, "listing_expired.tmpl", map[string]any{
+			"name":      listing.SellerName,
+			"title":     listing.Title,
+			"listingID": listing.ID,
+		})
+	case listing.SellerPhone != "":
+		err = app.sms.Send(app.internationalPhone(listing.SellerPhone), fmt.Sprintf(
+			"Your Ghost Protocols listing %q (#%d) has expired. Renew it to show it to buyers again.", listing.Title, listing.ID))
+	default:
+		app.logger.PrintInfo("expired listing seller has no contact details", props)
+		return
+	}
+
+	if err != nil {
+		app.logger.PrintError(err, props)
+		return
+	}
+
+	app.logger.PrintInfo("listing expiry notified", props)
+}
+
+// sweepUploadsJob periodically deletes uploads nothing has claimed, photos of
+// removed listings and replaced profile pictures until the server shuts down.
+func (app *application) sweepUploadsJob() {
+	ticker := time.NewTicker(app.config.media.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		app.sweepUploads()
+
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sweepUploads() {
+	uploads, err := app.models.MediaUploads.MarkSweepable(app.config.media.orphanAge, 500)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "sweep_uploads"})
+		return
+	}
+
+	swept := 0
+
+	for _, upload := range uploads {
+		err := app.deleteUpload(upload)
+		if err != nil {
+			// The upload stays in the deleting status and is retried on the next sweep.
+			app.logger.PrintError(err, map[string]string{"job": "sweep_uploads", "upload_id": upload.ID})
+			continue
+		}
+		swept++
+	}
+
+	if swept > 0 {
+		app.logger.PrintInfo("swept uploads", map[string]string{
+			"job":   "sweep_uploads",
+			"count": strconv.Itoa(swept),
+		})
+	}
+}
+
+func (app *application) deleteUpload(upload *data.MediaUpload) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	for _, key := range uploadKeys(upload) {
+		err := app.media.Delete(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if upload.Kind == data.UploadKindGallery {
+		err := app.removeCachedResizes(upload.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.models.MediaUploads.Delete(upload.ID)
+}
+
+// sweepTokensJob periodically deletes expired tokens and the failed sign ins of
+// identifiers that are no longer blocked until the server shuts down.
+func (app *application) sweepTokensJob() {
+	ticker := time.NewTicker(app.config.auth.sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		app.sweepTokens()
+		app.sweepLoginAttempts()
+
+		select {
+		case <-app.shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sweepTokens() {
+	deleted, err := app.models.Tokens.DeleteExpired()
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "sweep_tokens"})
+		return
+	}
+
+	if deleted > 0 {
+		app.logger.PrintInfo("swept expired tokens", map[string]string{
+			"job":   "sweep_tokens",
+			"count": strconv.FormatInt(deleted, 10),
+		})
+	}
+}
+
+func (app *application) sweepLoginAttempts() {
+	deleted, err := app.models.LoginAttempts.DeleteStale(loginLimits)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"job": "sweep_login_attempts"})
+		return
+	}
+
+	if deleted > 0 {
+		app.logger.PrintInfo("swept login attempts", map[string]string{
+			"job":   "sweep_login_attempts",
+			"count": strconv.FormatInt(deleted, 10),
+		})
+	}
+}
@@ -3,18 +3,13 @@ package main
 import (
 	"errors"
 	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
-
 	"net/http"
-	"os"
 
 	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/imaging"
 	"ghostprotocols.pk/internal/validator"
-	"github.com/chai2010/webp"
+	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"github.com/nfnt/resize"
 )
 
 func (app *application) getListingHandler(w http.ResponseWriter, r *http.Request) {
@@ -35,6 +30,14 @@ func (app *application) getListingHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Removed listings are gone for everyone, drafts are only visible to their seller.
+	user := app.contextGetUser(r)
+	if listing.Status == data.ListingStatusRemoved ||
+		(listing.Status == data.ListingStatusDraft && listing.Seller.ID != user.ID) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"listing": listing}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -82,7 +85,6 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	listing := &data.Listing{
-		Gallery:        input.Gallery,
 		MakeID:         input.Make,
 		ModelID:        input.Model,
 		VersionID:      versionID,
@@ -100,8 +102,29 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 		Details:        input.Details,
 		SellerID:       int32(user.ID),
 	}
+
 	v := validator.New()
 
+	listing.Gallery, err = app.resolveGallery(v, "gallery", listing, galleryURLs(input.Gallery))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.validateListing(v, listing)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Listings.Insert(listing)
 	if err != nil {
 		switch {
@@ -113,113 +136,489 @@ func (app *application) createListingHandler(w http.ResponseWriter, r *http.Requ
 		}
 		return
 	}
+
+	app.background(func() {
+		app.flagDuplicatePhotos(int64(listing.ID))
+		app.rerenderGallery(listing)
+	})
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-		return
 	}
+}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{}, nil)
+// validateListing fills in the fields the seller may leave out from the version's
+// details, then checks the listing on its own and against the catalog.
+func (app *application) validateListing(v *validator.Validator, listing *data.Listing) error {
+	catalog, err := app.models.Listings.GetCatalog(listing)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		return err
 	}
+
+	catalog.ApplyDefaults(listing)
+
+	data.ValidateListing(v, listing)
+	data.ValidateListingCatalog(v, listing, catalog)
+
+	return nil
 }
 
-func (app *application) saveGalleryHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse the form data
-	err := r.ParseMultipartForm(10 << 20) // Limit your file size to 10 MB
+func (app *application) updateListingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
 	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	// Retrieve the image file
-	file, header, err := r.FormFile("image")
+	user := app.contextGetUser(r)
+
+	listing, err := app.models.Listings.GetForUpdate(id)
 	if err != nil {
-		http.Error(w, "Unable to retrieve image file", http.StatusBadRequest)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if listing.Status == data.ListingStatusRemoved {
+		app.notFoundResponse(w, r)
 		return
 	}
-	defer file.Close()
 
-	// Determine the format of the image
-	format := header.Header.Get("Content-Type")
+	if int64(listing.SellerID) != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Gallery        []data.Image `json:"gallery"`
+		Make           *int32       `json:"make"`
+		Model          *int32       `json:"model"`
+		Version        *int32       `json:"version"`
+		Year           *int32       `json:"year"`
+		Price          *int64       `json:"price"`
+		Registration   *int32       `json:"registration"`
+		City           *int32       `json:"city"`
+		Area           *int32       `json:"area"`
+		Mileage        *string      `json:"mileage"`
+		Transmission   *int16       `json:"transmission"`
+		FuelType       *int16       `json:"fueltype"`
+		EngineCapacity *int32       `json:"engine_capacity"`
+		BodyType       *int16       `json:"body_type"`
+		Color          *int32       `json:"color"`
+		Details        *string      `json:"details"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
 
-	var img image.Image
+	v := validator.New()
 
-	switch format {
-	case "image/jpeg":
-		img, err = jpeg.Decode(file)
+	if input.Gallery != nil {
+		listing.Gallery, err = app.resolveGallery(v, "gallery", listing, galleryURLs(input.Gallery))
 		if err != nil {
-			http.Error(w, "Unable to decode JPEG image", http.StatusBadRequest)
+			app.serverErrorResponse(w, r, err)
 			return
 		}
-	case "image/png":
-		img, err = png.Decode(file)
-		if err != nil {
-			http.Error(w, "Unable to decode PNG image", http.StatusBadRequest)
+		if !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
 			return
 		}
-	case "image/webp":
-		img, err = webp.Decode(file)
+	}
+	if input.Make != nil {
+		listing.MakeID = *input.Make
+	}
+	if input.Model != nil {
+		listing.ModelID = *input.Model
+	}
+	if input.Version != nil {
+		listing.VersionID = *input.Version
+	}
+	if input.Year != nil {
+		listing.Year = *input.Year
+	}
+	if input.Price != nil {
+		listing.Price = *input.Price
+	}
+	if input.Registration != nil {
+		listing.RegistrationID = *input.Registration
+	}
+	if input.City != nil {
+		listing.CityID = *input.City
+	}
+	if input.Area != nil {
+		listing.AreaID = *input.Area
+	}
+	if input.Mileage != nil {
+		listing.Mileage = *input.Mileage
+	}
+	if input.Transmission != nil {
+		listing.TransmissionID = *input.Transmission
+	}
+	if input.FuelType != nil {
+		listing.FuelTypeID = *input.FuelType
+	}
+	if input.EngineCapacity != nil {
+		listing.EngineCapacity = *input.EngineCapacity
+	}
+	if input.BodyType != nil {
+		listing.BodyTypeID = *input.BodyType
+	}
+	if input.Color != nil {
+		listing.ColorID = *input.Color
+	}
+	if input.Details != nil {
+		listing.Details = *input.Details
+	}
+
+	err = app.validateListing(v, listing)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Listings.Update(listing)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Gallery != nil {
+		app.background(func() {
+			app.flagDuplicatePhotos(int64(listing.ID))
+			app.rerenderGallery(listing)
+		})
+	}
+
+	updated, err := app.models.Listings.GetById(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"listing": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateListingStatusHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.transitionListing(w, r, input.Status)
+}
+
+func (app *application) deleteListingHandler(w http.ResponseWriter, r *http.Request) {
+	app.transitionListing(w, r, data.ListingStatusRemoved)
+}
+
+// transitionListing moves the listing in the URL to status on behalf of its seller
+// and writes the updated listing, or the appropriate error, to the response.
+func (app *application) transitionListing(w http.ResponseWriter, r *http.Request, status string) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	listing, err := app.models.Listings.GetForUpdate(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if listing.Status == data.ListingStatusRemoved {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if int64(listing.SellerID) != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(status != "", "status", "must be provided")
+	v.Check(status == "" || listing.CanTransitionTo(status), "status", fmt.Sprintf("cannot move a %s listing to %q", listing.Status, status))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	listing.Status = status
+
+	err = app.models.Listings.UpdateStatus(listing, app.config.listings.refundGrace)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if status == data.ListingStatusRemoved {
+		err = app.writeJSON(w, http.StatusOK, envelope{"message": "listing successfully removed"}, nil)
 		if err != nil {
-			http.Error(w, "Unable to decode WebP image", http.StatusBadRequest)
-			return
+			app.serverErrorResponse(w, r, err)
 		}
-	default:
-		http.Error(w, "Unsupported image format", http.StatusBadRequest)
 		return
 	}
 
-	// Calculate new dimensions while maintaining aspect ratio
-	newHeight := uint(750)
-	bounds := img.Bounds()
-	width := uint(bounds.Dx())
-	height := uint(bounds.Dy())
-	newWidth := (newHeight * width) / height
+	updated, err := app.models.Listings.GetById(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
 
-	// Resize the image while maintaining aspect ratio
-	resizedImg := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+	err = app.writeJSON(w, http.StatusOK, envelope{"listing": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) renewListingHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
 
-	// Generate a UUID for the filename
-	uuid := uuid.New().String()
+	user := app.contextGetUser(r)
 
-	// Ensure the directory exists
-	err = os.MkdirAll("./public/media/listings", os.ModePerm)
+	listing, err := app.models.Listings.GetForUpdate(id)
 	if err != nil {
-		http.Error(w, "Unable to create directory for images", http.StatusInternalServerError)
-		fmt.Println("Error creating directory:", err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if listing.Status == data.ListingStatusRemoved {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	// Save the resized image as WebP
-	err = saveImageAsWebP(resizedImg, "./listings/images/"+uuid+".webp")
+	if int64(listing.SellerID) != user.ID {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(validator.PermittedValue(listing.Status, data.ListingStatusActive, data.ListingStatusExpired), "status", fmt.Sprintf("a %s listing cannot be renewed", listing.Status))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Listings.Renew(listing)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrListingLimitReached):
+			v.AddError("limit", "You have reached your Listing Limit")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	updated, err := app.models.Listings.GetById(id)
 	if err != nil {
-		http.Error(w, "Unable to save resized image", http.StatusInternalServerError)
-		fmt.Println("Error saving image:", err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	// Return the UUID
-	err = app.writeJSON(w, http.StatusCreated, envelope{"url": uuid + ".webp"}, nil)
+	err = app.writeJSON(w, http.StatusOK, envelope{"listing": updated}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
-func saveImageAsWebP(img image.Image, filepath string) error {
-	// Create the output file
-	out, err := os.Create(filepath)
+func (app *application) updateListingFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
 	if err != nil {
-		return fmt.Errorf("error creating file: %w", err)
+		app.notFoundResponse(w, r)
+		return
 	}
-	defer out.Close()
 
-	// Encode the image as WebP
-	err = webp.Encode(out, img, &webp.Options{Lossless: true})
+	listing, err := app.models.Listings.GetForUpdate(id)
 	if err != nil {
-		return fmt.Errorf("error encoding webp: %w", err)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
-	return nil
+	var input struct {
+		Featured    *bool `json:"featured"`
+		GpManaged   *bool `json:"gp_managed"`
+		GpCertified *bool `json:"gp_certified"`
+		GpYard      *bool `json:"gp_yard"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Featured != nil {
+		listing.Featured = *input.Featured
+	}
+	wasManaged := listing.GpManaged
+	if input.GpManaged != nil {
+		listing.GpManaged = *input.GpManaged
+	}
+	if input.GpCertified != nil {
+		listing.GpCertified = *input.GpCertified
+	}
+	if input.GpYard != nil {
+		listing.GpYard = *input.GpYard
+	}
+
+	err = app.models.Listings.Update(listing)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrFeaturedLimitReached):
+			v := validator.New()
+			v.AddError("featured", "the seller has reached their Featured Limit")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Managed listings are watermarked differently, so re-render their photos.
+	if listing.GpManaged != wasManaged {
+		app.background(func() {
+			app.rerenderGallery(listing)
+		})
+	}
+
+	updated, err := app.models.Listings.GetById(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"listing": updated}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// saveGalleryHandler accepts an image for a listing gallery and queues it for
+// processing. Clients poll getGalleryUploadHandler until it is ready.
+func (app *application) saveGalleryHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := app.readUpload(w, r, "image")
+	if err == nil {
+		err = imaging.Check(body, app.maxUploadPixels())
+	}
+	if err != nil {
+		app.imageUploadErrorResponse(w, r, err)
+		return
+	}
+
+	upload, err := app.queueGalleryUpload(app.contextGetUser(r).ID, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, errImageQueueFull):
+			app.serverBusyResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The renditions' names are known up front, their dimensions once processed
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"upload": galleryUploadResponse(upload)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getGalleryUploadHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "uuid"))
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	upload, err := app.models.MediaUploads.Get(id.String())
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if upload.Kind != data.UploadKindGallery || upload.OwnerID != app.contextGetUser(r).ID {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"upload": galleryUploadResponse(upload)}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func galleryUploadResponse(upload *data.MediaUpload) envelope {
+	return envelope{
+		"id":     upload.ID,
+		"status": upload.Processing,
+		"url":    galleryImage(upload).Url,
+		"image":  galleryImage(upload),
+	}
 }
 
 func (app *application) getListingsByFilter(w http.ResponseWriter, r *http.Request) {
@@ -251,6 +650,13 @@ func (app *application) getListingsByFilter(w http.ResponseWriter, r *http.Reque
 	input.ListingFilter.Active = app.readBool(qs, "active", v)
 	input.ListingFilter.Featured = app.readBool(qs, "featured", v)
 	input.ListingFilter.GpManaged = app.readBool(qs, "gp_managed", v)
+	input.ListingFilter.Status = app.readString(qs, "status", data.ListingStatusActive)
+
+	v.Check(validator.PermittedValue(input.ListingFilter.Status, data.ListingStatusActive, data.ListingStatusSold), "status", "must be active or sold")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
 
 	listings, metadata, err := app.models.Listings.GetAll(input.ListingFilter, input.Sorting)
 	if err != nil {
@@ -297,6 +703,7 @@ func (app *application) getHomeFeed(w http.ResponseWriter, r *http.Request) {
 	input.ListingFilter.Active = &setTrue
 	input.ListingFilter.Featured = &setTrue
 	input.ListingFilter.GpManaged = &setFalse
+	input.ListingFilter.Status = data.ListingStatusActive
 
 	featuredListings, _, err := app.models.Listings.GetAll(input.ListingFilter, input.Sorting)
 	if err != nil {
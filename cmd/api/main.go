@@ -3,13 +3,20 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"flag"
+	"fmt"
+	"image"
+	"image/png"
 	"os"
 	"sync"
 	"time"
 
 	"ghostprotocols.pk/internal/data"
 	"ghostprotocols.pk/internal/jsonlog"
+	"ghostprotocols.pk/internal/mailer"
+	"ghostprotocols.pk/internal/media"
+	"ghostprotocols.pk/internal/sms"
 
 	_ "github.com/lib/pq"
 	"github.com/patrickmn/go-cache"
@@ -32,6 +39,65 @@ type config struct {
 		burst   int
 		enabled bool
 	}
+
+	auth struct {
+		// accessTTL is how long an access token lasts before the client has to
+		// exchange its refresh token for a new one.
+		accessTTL  time.Duration
+		refreshTTL time.Duration
+		// sweepInterval is how often expired tokens are deleted.
+		sweepInterval time.Duration
+	}
+
+	smtp struct {
+		host     string
+		port     int
+		username string
+		password string
+		sender   string
+	}
+
+	mailer string
+
+	sms struct {
+		provider    string
+		countryCode string
+		twilio      struct {
+			accountSID string
+			authToken  string
+			from       string
+		}
+	}
+
+	listings struct {
+		refundGrace    time.Duration
+		expiryInterval time.Duration
+	}
+
+	media struct {
+		backend string
+		root    string
+		s3      media.S3Config
+		// cacheDir holds listing images resized on request.
+		cacheDir string
+
+		// maxMegapixels rejects decompression bombs before they are decoded.
+		maxMegapixels float64
+		workers       int
+		queueSize     int
+
+		// watermarkLogo is the path of a PNG composited onto gallery images.
+		watermarkLogo      string
+		watermarkListingID bool
+
+		// duplicateDistance is how many bits two photo hashes may differ by and
+		// still be flagged as the same photo.
+		duplicateDistance int
+
+		// orphanAge is how long an upload may go unclaimed before it is swept.
+		orphanAge     time.Duration
+		sweepInterval time.Duration
+	}
 }
 
 type application struct {
@@ -40,6 +106,20 @@ type application struct {
 	models data.Models
 	wg     sync.WaitGroup
 	cache  *cache.Cache
+	media  media.MediaStore
+	mailer mailer.Mailer
+	sms    sms.SMSSender
+	// images queues gallery uploads for the image workers. Sends hold imagesMu so
+	// that a batch of uploads is queued whole or not at all.
+	images   chan imageJob
+	imagesMu sync.Mutex
+	// rerenders queues gallery images to be rendered again from their originals.
+	rerenders chan imageJob
+	// watermarkLogo is the decoded logo of the gallery watermark, nil if none.
+	watermarkLogo image.Image
+	// shutdown is closed when the server starts shutting down so that long-running
+	// background jobs know to return.
+	shutdown chan struct{}
 }
 
 func main() {
@@ -57,6 +137,44 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 15, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	flag.DurationVar(&cfg.auth.accessTTL, "auth-access-ttl", 15*time.Minute, "Lifetime of access tokens")
+	flag.DurationVar(&cfg.auth.refreshTTL, "auth-refresh-ttl", 30*24*time.Hour, "Lifetime of refresh tokens, renewed every time one is rotated")
+	flag.DurationVar(&cfg.auth.sweepInterval, "auth-sweep-interval", time.Hour, "How often to delete expired tokens and old failed sign ins")
+
+	flag.StringVar(&cfg.mailer, "mailer", "log", "Mail delivery (smtp|log), log is refused in production")
+	flag.StringVar(&cfg.smtp.host, "smtp-host", "localhost", "SMTP host")
+	flag.IntVar(&cfg.smtp.port, "smtp-port", 25, "SMTP port")
+	flag.StringVar(&cfg.smtp.username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.smtp.password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Ghost Protocols <no-reply@ghostprotocols.pk>", "SMTP sender")
+
+	flag.StringVar(&cfg.sms.provider, "sms", "log", "SMS delivery (twilio|log), log is refused in production")
+	flag.StringVar(&cfg.sms.countryCode, "sms-country-code", "+92", "Country code prefixed to stored phone numbers")
+	flag.StringVar(&cfg.sms.twilio.accountSID, "twilio-account-sid", "", "Twilio account SID")
+	flag.StringVar(&cfg.sms.twilio.authToken, "twilio-auth-token", "", "Twilio auth token")
+	flag.StringVar(&cfg.sms.twilio.from, "twilio-from", "", "Twilio sender number")
+
+	flag.DurationVar(&cfg.listings.refundGrace, "listings-refund-grace", 24*time.Hour, "Window after creation in which removing a listing refunds the listing slot")
+	flag.StringVar(&cfg.media.backend, "media-backend", "local", "Media storage backend (local|s3)")
+	flag.StringVar(&cfg.media.root, "media-root", "./public/media", "Directory uploaded media is stored in by the local backend")
+	flag.StringVar(&cfg.media.cacheDir, "media-cache-dir", "./cache/media", "Directory resized listing images are cached in")
+	flag.StringVar(&cfg.media.s3.Endpoint, "s3-endpoint", "", "S3-compatible endpoint URL, e.g. http://localhost:9000")
+	flag.StringVar(&cfg.media.s3.Region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&cfg.media.s3.Bucket, "s3-bucket", "", "S3 bucket for media")
+	flag.StringVar(&cfg.media.s3.AccessKey, "s3-access-key", "", "S3 access key")
+	flag.StringVar(&cfg.media.s3.SecretKey, "s3-secret-key", "", "S3 secret key")
+	flag.BoolVar(&cfg.media.s3.PathStyle, "s3-path-style", true, "Use path-style S3 addressing")
+	flag.Float64Var(&cfg.media.maxMegapixels, "media-max-megapixels", 40, "Largest image, in megapixels, accepted for upload")
+	flag.IntVar(&cfg.media.workers, "media-workers", 4, "Number of background workers processing uploaded images")
+	flag.IntVar(&cfg.media.queueSize, "media-queue-size", 100, "Uploaded images that may wait for a worker before uploads are refused")
+	flag.IntVar(&cfg.media.duplicateDistance, "media-duplicate-distance", 6, "Largest difference, in bits, between photo hashes flagged as duplicates")
+	flag.StringVar(&cfg.media.watermarkLogo, "media-watermark-logo", "", "PNG logo watermarked onto listing photos (disabled when empty)")
+	flag.BoolVar(&cfg.media.watermarkListingID, "media-watermark-listing-id", true, "Watermark listing photos with the listing ID")
+	flag.DurationVar(&cfg.media.orphanAge, "media-orphan-age", 24*time.Hour, "How long an upload may go unclaimed before it is deleted")
+	flag.DurationVar(&cfg.media.sweepInterval, "media-sweep-interval", time.Hour, "How often to delete unclaimed and replaced uploads")
+
+	flag.DurationVar(&cfg.listings.expiryInterval, "listings-expiry-interval", time.Hour, "How often to expire listings past their expiry date")
+
 	flag.Parse()
 
 	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
@@ -69,13 +187,46 @@ func main() {
 
 	c := cache.New(15*time.Minute, 30*time.Minute)
 
+	store, err := openMediaStore(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	logo, err := openWatermarkLogo(cfg.media.watermarkLogo)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	mail, err := openMailer(cfg)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	sender, err := openSMSSender(cfg, logger)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
 	app := &application{
-		config: cfg,
-		logger: logger,
-		models: data.NewModels(db),
-		cache:  c,
+		config:    cfg,
+		logger:    logger,
+		models:    data.NewModels(db),
+		cache:     c,
+		shutdown:  make(chan struct{}),
+		media:     store,
+		mailer:    mail,
+		sms:       sender,
+		images:    make(chan imageJob, cfg.media.queueSize),
+		rerenders: make(chan imageJob, cfg.media.queueSize),
+
+		watermarkLogo: logo,
 	}
 
+	app.background(app.expireListingsJob)
+	app.background(app.sweepUploadsJob)
+	app.background(app.sweepTokensJob)
+	app.startImageWorkers()
+
 	err = app.serve()
 	if err != nil {
 		logger.PrintFatal(err, nil)
@@ -109,3 +260,64 @@ func openDB(cfg config) (*sql.DB, error) {
 
 	return db, nil
 }
+
+// Function to pick the media storage backend
+func openMediaStore(cfg config) (media.MediaStore, error) {
+	switch cfg.media.backend {
+	case "local":
+		return media.NewLocalStore(cfg.media.root), nil
+	case "s3":
+		return media.NewS3Store(cfg.media.s3)
+	default:
+		return nil, fmt.Errorf("unknown media backend %q", cfg.media.backend)
+	}
+}
+
+func openMailer(cfg config) (mailer.Mailer, error) {
+	switch cfg.mailer {
+	case "smtp":
+		return mailer.NewSMTP(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender), nil
+	case "log":
+		// The log mailer writes activation and password reset tokens out in full.
+		if cfg.env == "production" {
+			return nil, errors.New("the log mailer must not be used in production")
+		}
+		return mailer.NewLog(os.Stdout), nil
+	default:
+		return nil, fmt.Errorf("unknown mailer %q", cfg.mailer)
+	}
+}
+
+func openSMSSender(cfg config, logger *jsonlog.Logger) (sms.SMSSender, error) {
+	switch cfg.sms.provider {
+	case "twilio":
+		return sms.NewTwilio(cfg.sms.twilio.accountSID, cfg.sms.twilio.authToken, cfg.sms.twilio.from), nil
+	case "log":
+		// The log sender writes one-time codes and password reset tokens out in full.
+		if cfg.env == "production" {
+			return nil, errors.New("the log sms sender must not be used in production")
+		}
+		return sms.NewLog(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown sms provider %q", cfg.sms.provider)
+	}
+}
+
+func openWatermarkLogo(path string) (image.Image, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	logo, err := png.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid watermark logo: %w", err)
+	}
+
+	return logo, nil
+}
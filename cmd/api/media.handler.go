@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"ghostprotocols.pk/internal/media"
+	"ghostprotocols.pk/internal/validator"
+	"github.com/chai2010/webp"
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// publicMediaPrefixes are the parts of the media store served to clients. Gallery
+// originals are kept unwatermarked and so must never be served.
+var publicMediaPrefixes = []string{"listings/", "user-profile/"}
+
+func (app *application) serveMediaHandler(w http.ResponseWriter, r *http.Request) {
+	app.serveMedia(w, r, chi.URLParam(r, "*"))
+}
+
+// serveMedia writes the object stored under key, provided it is public.
+func (app *application) serveMedia(w http.ResponseWriter, r *http.Request, key string) {
+	public := false
+	for _, prefix := range publicMediaPrefixes {
+		if strings.HasPrefix(key, prefix) && !strings.Contains(key, "..") {
+			public = true
+		}
+	}
+	if !public {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	object, err := app.media.Get(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrNotFound), errors.Is(err, media.ErrInvalidKey):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+	defer object.Body.Close()
+
+	if object.ContentType != "" {
+		w.Header().Set("Content-Type", object.ContentType)
+	}
+
+	// Local files can be served with range and conditional request support.
+	if body, ok := object.Body.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, path.Base(key), object.ModTime, body)
+		return
+	}
+
+	if !object.ModTime.IsZero() {
+		w.Header().Set("Last-Modified", object.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if object.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+	}
+
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, object.Body)
+}
+
+// resizeWidths are the widths listing images may be requested in. Nothing wider
+// than the full rendition is offered as it would only be upscaled.
+var resizeWidths = []int{160, 320, 480, 640, 960, 1280}
+
+// serveListingImageHandler serves a listing image resized to the width in the w
+// query parameter. Resized images are cached on disk and regenerated when the
+// stored image changes, for example after its watermark is re-rendered. Requests
+// without w are served the stored file.
+func (app *application) serveListingImageHandler(w http.ResponseWriter, r *http.Request) {
+	file := chi.URLParam(r, "file")
+
+	qs := r.URL.Query()
+	if !qs.Has("w") {
+		app.serveMedia(w, r, "listings/"+file)
+		return
+	}
+
+	v := validator.New()
+
+	width := app.readInt(qs, "w", 0, v)
+	v.Check(validator.PermittedValue(width, resizeWidths...), "w", "must be one of 160, 320, 480, 640, 960 or 1280")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	id, err := uuid.Parse(strings.TrimSuffix(file, ".webp"))
+	if err != nil || !strings.HasSuffix(file, ".webp") {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	key := "listings/" + file
+
+	source, err := app.media.Stat(r.Context(), key)
+	if err != nil {
+		switch {
+		case errors.Is(err, media.ErrNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/webp")
+	w.Header().Set("Cache-Control", "public, max-age=2592000")
+	w.Header().Set("ETag", fmt.Sprintf(`"%s-w%d-%x"`, id, width, source.ModTime.UnixNano()))
+
+	cachePath := filepath.Join(app.config.media.cacheDir, fmt.Sprintf("%s_w%d.webp", id, width))
+
+	cached, err := os.Open(cachePath)
+	if err == nil {
+		defer cached.Close()
+
+		info, err := cached.Stat()
+		if err == nil && !info.ModTime().Before(source.ModTime) {
+			http.ServeContent(w, r, file, source.ModTime, cached)
+			return
+		}
+	}
+
+	resized, err := app.resizeListingImage(r.Context(), key, width)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = writeFileAtomic(cachePath, resized)
+	if err != nil {
+		// The cache is an optimisation, the resized image can still be served.
+		app.logError(r, err)
+	}
+
+	http.ServeContent(w, r, file, source.ModTime, bytes.NewReader(resized))
+}
+
+// resizeListingImage reads the image stored under key and returns it scaled down
+// to width and encoded as WebP.
+func (app *application) resizeListingImage(ctx context.Context, key string, width int) ([]byte, error) {
+	object, err := app.media.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Body.Close()
+
+	img, err := webp.Decode(object.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+
+	err = webp.Encode(&buf, resizeToWidth(img, uint(width)), &webp.Options{Quality: 75})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// removeCachedResizes deletes every resized copy of a listing image from the disk
+// cache.
+func (app *application) removeCachedResizes(id string) error {
+	matches, err := filepath.Glob(filepath.Join(app.config.media.cacheDir, id+"_w*.webp"))
+	if err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+		err := os.Remove(match)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/validator"
+)
+
+// listDuplicatePhotosHandler lists listing photos suspected of being copied from
+// another seller's listing, optionally for a single listing.
+func (app *application) listDuplicatePhotosHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ListingID int
+		data.Sorting
+	}
+
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.ListingID = app.readInt(qs, "listing_id", 0, v)
+	input.Sorting.Page = app.readInt(qs, "page", 1, v)
+	input.Sorting.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Sorting.Sort = "-created_at"
+	input.Sorting.SortSafelist = []string{"-created_at"}
+
+	v.Check(input.ListingID >= 0, "listing_id", "must not be negative")
+	if data.ValidateFilters(v, input.Sorting); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	duplicates, metadata, err := app.models.DuplicatePhotos.GetAll(int64(input.ListingID), input.Sorting)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"duplicates": duplicates, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
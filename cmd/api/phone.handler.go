@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/validator"
+)
+
+// otpLimits keeps codes short-lived and caps how many texts and guesses a user
+// gets.
+var otpLimits = data.OTPLimits{
+	TTL:         10 * time.Minute,
+	Cooldown:    time.Minute,
+	MaxSends:    5,
+	SendWindow:  time.Hour,
+	MaxAttempts: 5,
+}
+
+// sendPhoneOTPHandler texts a one-time code to the authenticated user's phone.
+func (app *application) sendPhoneOTPHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	v := validator.New()
+
+	v.Check(!user.PhoneVerified, "phone", "is already verified")
+	if data.ValidatePhone(v, user.Phone); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	otp, err := app.models.PhoneOTPs.New(user.ID, user.Phone, otpLimits)
+	if err != nil {
+		var limited *data.OTPRateLimitedError
+
+		switch {
+		case errors.As(err, &limited):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			app.rateLimitExceededResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.background(func() {
+		message := fmt.Sprintf("Your Ghost Protocols verification code is %s. It expires in %.0f minutes.",
+			otp.Plaintext, otpLimits.TTL.Minutes())
+
+		err := app.sms.Send(app.internationalPhone(otp.Phone), message)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": fmt.Sprint(otp.UserID)})
+		}
+	})
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"expiry": otp.Expiry}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) verifyPhoneOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateOTPPlaintext(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	err = app.models.PhoneOTPs.Verify(user.ID, user.Phone, input.Code, otpLimits)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrOTPInvalid):
+			v.AddError("code", "invalid or expired code")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrOTPAttemptsExceeded):
+			v.AddError("code", "too many incorrect attempts, please request a new code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"phone_verified": true}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// internationalPhone returns phone in international format. Numbers are stored
+// without the country code.
+func (app *application) internationalPhone(phone string) string {
+	if strings.HasPrefix(phone, "+") {
+		return phone
+	}
+	return app.config.sms.countryCode + strings.TrimPrefix(phone, "0")
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"net/http"
-
+	"ghostprotocols.pk/internal/data"
 	"github.com/go-chi/chi/v5"
 )
 
@@ -16,31 +15,60 @@ func (app *application) routes() *chi.Mux {
 	r.Use(app.authenticate, app.enableCORS)
 
 	r.Get("/v1/healthcheck", app.healthcheckHandler)
-	r.Get("/v1/update/makes", app.updateMakes)
-	r.Get("/v1/update/models", app.updateModels)
-	r.Get("/v1/update/generations", app.updateGenerations)
-	r.Get("/v1/update/versions", app.updateVersions)
-	r.Get("/v1/update/colors", app.updateColors)
-	r.Get("/v1/update/transmissions", app.updateTransmissions)
-	r.Get("/v1/update/body_types", app.updateBodyTypes)
-	r.Get("/v1/update/fuel_types", app.updateFuelTypes)
-	r.Get("/v1/update/cities", app.updateCities)
-	r.Get("/v1/update/areas", app.updateAreas)
-	r.Get("/v1/update/registrations", app.updateRegistration)
+	r.Get("/v1/catalog/changes", app.getCatalogChangesHandler)
+	r.Get("/v1/catalog/{kind}", app.getCatalogHandler)
+	r.Post("/v1/update/{kind}", app.requirePermission(data.PermissionCatalogWrite, app.updateCatalogHandler))
+
+	r.Post("/v1/admin/catalog/makes", app.requirePermission(data.PermissionCatalogWrite, app.createMakeHandler))
+	r.Patch("/v1/admin/catalog/makes/{id}", app.requirePermission(data.PermissionCatalogWrite, app.updateMakeHandler))
+	r.Post("/v1/admin/catalog/models", app.requirePermission(data.PermissionCatalogWrite, app.createModelHandler))
+	r.Patch("/v1/admin/catalog/models/{id}", app.requirePermission(data.PermissionCatalogWrite, app.updateModelHandler))
+	r.Post("/v1/admin/catalog/generations", app.requirePermission(data.PermissionCatalogWrite, app.createGenerationHandler))
+	r.Patch("/v1/admin/catalog/generations/{id}", app.requirePermission(data.PermissionCatalogWrite, app.updateGenerationHandler))
+	r.Post("/v1/admin/catalog/versions", app.requirePermission(data.PermissionCatalogWrite, app.createVersionHandler))
+	r.Patch("/v1/admin/catalog/versions/{id}", app.requirePermission(data.PermissionCatalogWrite, app.updateVersionHandler))
+	r.Post("/v1/admin/catalog/import", app.requirePermission(data.PermissionCatalogWrite, app.importCatalogHandler))
+	r.Post("/v1/admin/catalog/{kind}/{id}/publish", app.requirePermission(data.PermissionCatalogWrite, app.publishCatalogRecordHandler))
+	r.Post("/v1/admin/catalog/{kind}/{id}/unpublish", app.requirePermission(data.PermissionCatalogWrite, app.unpublishCatalogRecordHandler))
+
+	r.Get("/v1/admin/users/{id}/permissions", app.requirePermission(data.PermissionUsersManage, app.getUserPermissionsHandler))
+	r.Post("/v1/admin/users/{id}/permissions", app.requirePermission(data.PermissionUsersManage, app.grantUserPermissionsHandler))
+	r.Delete("/v1/admin/users/{id}/permissions", app.requirePermission(data.PermissionUsersManage, app.revokeUserPermissionsHandler))
 
 	r.Post("/v1/users/register", app.registerUserHandler)
+	r.Put("/v1/users/activated", app.activateUserHandler)
+	r.Post("/v1/users/phone/otp", app.requireAuthenticatedUser(app.sendPhoneOTPHandler))
+	r.Post("/v1/users/phone/verify", app.requireAuthenticatedUser(app.verifyPhoneOTPHandler))
 	r.Get("/v1/users/getDetails", app.requireAuthenticatedUser(app.getUserHandler))
 	r.Put("/v1/users/update", app.requireAuthenticatedUser(app.updateUserHandler))
 	r.Post("/v1/users/updateProfilePic", app.requireAuthenticatedUser(app.updateProfilePicHandler))
+	r.Put("/v1/users/password", app.updateUserPasswordHandler)
 	r.Post("/v1/users/authentication", app.createAuthenticationTokenHandler)
+	r.Post("/v1/tokens/activation", app.createActivationTokenHandler)
+	r.Post("/v1/tokens/refresh", app.refreshTokenHandler)
+	r.Post("/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	r.Delete("/v1/tokens/current", app.requireAuthenticatedUser(app.deleteCurrentTokenHandler))
+	r.Get("/v1/users/sessions", app.requireAuthenticatedUser(app.listUserSessionsHandler))
+	r.Delete("/v1/users/sessions/{id}", app.requireAuthenticatedUser(app.deleteUserSessionHandler))
 
 	r.Get("/v1/listings/{id}", app.getListingHandler)
-	r.Post("/v1/listings", app.requireAuthenticatedUser(app.createListingHandler))
+	r.Post("/v1/listings", app.requireActivatedUser(app.createListingHandler))
+	r.Patch("/v1/listings/{id}", app.requireAuthenticatedUser(app.updateListingHandler))
+	r.Delete("/v1/listings/{id}", app.requireAuthenticatedUser(app.deleteListingHandler))
+	r.Put("/v1/listings/{id}/status", app.requireAuthenticatedUser(app.updateListingStatusHandler))
+	r.Post("/v1/listings/{id}/renew", app.requireAuthenticatedUser(app.renewListingHandler))
+	r.Put("/v1/listings/{id}/gallery", app.requireAuthenticatedUser(app.updateListingGalleryHandler))
+	r.Put("/v1/listings/{id}/flags", app.requirePermission(data.PermissionListingsManage, app.updateListingFlagsHandler))
 	r.Post("/v1/gallery", app.requireAuthenticatedUser(app.saveGalleryHandler))
+	r.Post("/v1/gallery/batch", app.requireAuthenticatedUser(app.saveGalleryBatchHandler))
+	r.Get("/v1/gallery/{uuid}", app.requireAuthenticatedUser(app.getGalleryUploadHandler))
 	r.Get("/v1/listings", app.getListingsByFilter)
 	r.Get("/v1/listings/home", app.getHomeFeed)
 
-	r.Handle("/media/*", http.StripPrefix("/media/", http.FileServer(http.Dir("public/media"))))
+	r.Get("/v1/moderation/duplicates", app.requirePermission(data.PermissionListingsManage, app.listDuplicatePhotosHandler))
+
+	r.Get("/media/listings/{file}", app.serveListingImageHandler)
+	r.Get("/media/*", app.serveMediaHandler)
 
 	return r
 }
@@ -42,6 +42,8 @@ func (app *application) serve() error {
 			"addr": srv.Addr,
 		})
 
+		close(app.shutdown)
+
 		app.wg.Wait()
 		shutdownError <- nil
 	}()
@@ -2,7 +2,9 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 	"time"
 
 	"ghostprotocols.pk/internal/data"
@@ -23,60 +25,266 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 
 	v := validator.New()
 
-	if input.Identifier == "" {
-		v.AddError("identifier", "must be provided")
-	} else {
-		if validator.Matches(input.Identifier, validator.EmailRX) {
-			data.ValidateEmail(v, input.Identifier)
-		} else if validator.Matches(input.Identifier, validator.PhoneRX) {
-			data.ValidatePhone(v, input.Identifier)
-		} else {
-			v.AddError("identifier", "must be a valid email address or phone number")
-		}
-	}
-
+	validateIdentifier(v, input.Identifier)
 	data.ValidatePasswordPlaintext(v, input.Password)
 	if !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	var user *data.User
-	if validator.Matches(input.Identifier, validator.EmailRX) {
-		user, err = app.models.Users.GetByEmail(input.Identifier)
-	} else if validator.Matches(input.Identifier, validator.PhoneRX) {
-		user, err = app.models.Users.GetByPhone(input.Identifier)
+	attempt, err := app.models.LoginAttempts.Attempt(input.Identifier, loginLimits)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if attempt.BlockedFor > 0 {
+		app.tooManyLoginAttemptsResponse(w, r, attempt.BlockedFor)
+		return
+	}
+
+	// Unknown identifiers go through a password check and count as a failure like
+	// a wrong password does, so neither the response nor its timing gives away
+	// whether an account exists.
+	var match bool
+
+	user, err := app.getUserByIdentifier(input.Identifier)
+	switch {
+	case err == nil:
+		match, err = user.Password.Matches(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	case errors.Is(err, data.ErrRecordNotFound):
+		data.SimulatePasswordMatch(input.Password)
+	default:
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.logLockout(r, input.Identifier, attempt)
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.LoginAttempts.Reset(input.Identifier)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	access, refresh, err := app.models.Tokens.NewSession(user.ID, clientIP(r), r.UserAgent(), app.sessionTTL())
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// loginLimits slows down password guessing against a single identifier and locks
+// it out after too many failures, however many addresses the guesses come from.
+var loginLimits = data.LoginLimits{
+	FreeAttempts: 3,
+	BaseDelay:    time.Second,
+	MaxFailures:  10,
+	Lockout:      15 * time.Minute,
+}
+
+// logLockout logs a failed sign in if it locked identifier out.
+func (app *application) logLockout(r *http.Request, identifier string, attempt *data.LoginAttempt) {
+	if !attempt.LockedOut {
+		return
+	}
+
+	app.logger.PrintInfo("identifier locked out after failed sign ins", map[string]string{
+		"identifier":    identifier,
+		"failures":      strconv.Itoa(attempt.Failures),
+		"blocked_until": attempt.BlockedUntil.Format(time.RFC3339),
+		"ip":            clientIP(r),
+	})
+}
+
+// refreshTokenHandler exchanges a refresh token for a new access token and a new
+// refresh token. The old refresh token stops working.
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
 	}
 
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	access, refresh, err := app.models.Tokens.Rotate(input.RefreshToken, clientIP(r), r.UserAgent(), app.sessionTTL())
 	if err != nil {
+		var reused *data.TokenReusedError
+
 		switch {
+		case errors.As(err, &reused):
+			app.logger.PrintInfo("refresh token reused, session revoked", map[string]string{
+				"user_id":    strconv.FormatInt(reused.UserID, 10),
+				"session_id": strconv.FormatInt(reused.FamilyID, 10),
+				"ip":         clientIP(r),
+			})
+			app.invalidAuthenticationTokenResponse(w, r)
 		case errors.Is(err, data.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			app.invalidAuthenticationTokenResponse(w, r)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	match, err := user.Password.Matches(input.Password)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": access, "refresh_token": refresh}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) sessionTTL() data.SessionTTL {
+	return data.SessionTTL{
+		Access:  app.config.auth.accessTTL,
+		Refresh: app.config.auth.refreshTTL,
+	}
+}
+
+// createPasswordResetTokenHandler sends a password reset token to the email address
+// or phone number given as the identifier. The response is the same whether or not
+// an account matches, so it cannot be used to find out who has one.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Identifier string `json:"identifier"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
-	if !match {
-		app.invalidCredentialsResponse(w, r)
+	v := validator.New()
+
+	if validateIdentifier(v, input.Identifier); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.getUserByIdentifier(input.Identifier)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	if user != nil {
+		token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			var err error
+
+			if validator.Matches(input.Identifier, validator.EmailRX) {
+				err = app.mailer.Send(user.Email, "token_password_reset.tmpl", map[string]any{
+					"passwordResetToken": token.Plaintext,
+				})
+			} else {
+				err = app.sms.Send(app.internationalPhone(user.Phone), fmt.Sprintf(
+					"Your Ghost Protocols password reset token is %s. It expires in 45 minutes.", token.Plaintext))
+			}
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	env := envelope{"message": "if an account matches, you will receive password reset instructions shortly"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createActivationTokenHandler sends a new activation token to a user whose
+// earlier one expired or never arrived. Like password resets, the response does
+// not say whether the email address belongs to an account.
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if user != nil && !user.EmailVerfied {
+		err = app.sendActivationToken(user, "token_activation.tmpl")
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"message": "if the account needs activating, you will receive an email with activation instructions shortly"}
+
+	err = app.writeJSON(w, http.StatusAccepted, env, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// validateIdentifier checks that identifier is an email address or a phone number.
+func validateIdentifier(v *validator.Validator, identifier string) {
+	if identifier == "" {
+		v.AddError("identifier", "must be provided")
+	} else {
+		if validator.Matches(identifier, validator.EmailRX) {
+			data.ValidateEmail(v, identifier)
+		} else if validator.Matches(identifier, validator.PhoneRX) {
+			data.ValidatePhone(v, identifier)
+		} else {
+			v.AddError("identifier", "must be a valid email address or phone number")
+		}
+	}
+}
+
+// getUserByIdentifier looks up a user by the email address or phone number in a
+// validated identifier.
+func (app *application) getUserByIdentifier(identifier string) (*data.User, error) {
+	if validator.Matches(identifier, validator.EmailRX) {
+		return app.models.Users.GetByEmail(identifier)
+	}
+	return app.models.Users.GetByPhone(identifier)
+}
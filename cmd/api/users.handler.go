@@ -2,19 +2,14 @@ package main
 
 import (
 	"errors"
-	"fmt"
-	"image"
-	"image/jpeg"
-	"image/png"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
 	"ghostprotocols.pk/internal/data"
 	"ghostprotocols.pk/internal/validator"
 
-	"github.com/chai2010/webp"
 	"github.com/google/uuid"
-	"github.com/nfnt/resize"
 )
 
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
@@ -89,12 +84,166 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	err = app.sendActivationToken(user, "user_welcome.tmpl")
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJSON(w, http.StatusCreated, envelope{"user": user, "dealer": dealer}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
 
+// sendActivationToken replaces any activation tokens of user with a new one and
+// emails it to them in the background using templateFile.
+func (app *application) sendActivationToken(user *data.User, templateFile string) error {
+	err := app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 3*24*time.Hour, data.ScopeActivation)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+		data := map[string]any{
+			"activationToken": token.Plaintext,
+			"userID":          user.ID,
+		}
+
+		err := app.mailer.Send(user.Email, templateFile, data)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"user_id": strconv.FormatInt(user.ID, 10)})
+		}
+	})
+
+	return nil
+}
+
+func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Users.SetEmailVerified(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidatePasswordPlaintext(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.UpdatePassword(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// Sign the user out everywhere, as whoever knew the old password may be signed in.
+	for _, scope := range []string{data.ScopePasswordReset, data.ScopeAuthentication, data.ScopeRefresh} {
+		err = app.models.Tokens.DeleteAllForUser(scope, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{"message": "your password was successfully reset"}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
 func (app *application) updateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	user := app.contextGetUser(r)
@@ -222,82 +371,41 @@ func (app *application) updateProfilePicHandler(w http.ResponseWriter, r *http.R
 
 	user := app.contextGetUser(r)
 
-	// Parse the form data
-	err := r.ParseMultipartForm(10 << 20) // Limit your file size to 10 MB
-	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
-		return
-	}
-
-	// Retrieve the image file
-	file, header, err := r.FormFile("image")
+	img, err := app.readImageUpload(w, r, "image")
 	if err != nil {
-		http.Error(w, "Unable to retrieve image file", http.StatusBadRequest)
+		app.imageUploadErrorResponse(w, r, err)
 		return
 	}
-	defer file.Close()
 
-	// Determine the format of the image
-	format := header.Header.Get("Content-Type")
-
-	var img image.Image
-
-	switch format {
-	case "image/jpeg":
-		img, err = jpeg.Decode(file)
-		if err != nil {
-			http.Error(w, "Unable to decode JPEG image", http.StatusBadRequest)
-			return
-		}
-	case "image/png":
-		img, err = png.Decode(file)
-		if err != nil {
-			http.Error(w, "Unable to decode PNG image", http.StatusBadRequest)
-			return
-		}
-	case "image/webp":
-		img, err = webp.Decode(file)
-		if err != nil {
-			http.Error(w, "Unable to decode WebP image", http.StatusBadRequest)
-			return
-		}
-	default:
-		http.Error(w, "Unsupported image format", http.StatusBadRequest)
-		return
-	}
-
-	// Calculate new dimensions while maintaining aspect ratio
-	newHeight := uint(200)
-	bounds := img.Bounds()
-	width := uint(bounds.Dx())
-	height := uint(bounds.Dy())
-	newWidth := (newHeight * width) / height
-
-	// Resize the image while maintaining aspect ratio
-	resizedImg := resize.Resize(newWidth, newHeight, img, resize.Lanczos3)
+	// Resize the image to 200px high while maintaining aspect ratio
+	resizedImg := resizeToHeight(img, 200)
 
 	// Generate a UUID for the filename
 	uuid := uuid.New().String()
 
-	// Ensure the directory exists
-	err = os.MkdirAll("./public/media/user-profile", os.ModePerm)
+	// Record the upload first so the sweeper removes its file if it is never set
+	err = app.models.MediaUploads.Insert(&data.MediaUpload{
+		ID:         uuid,
+		OwnerID:    user.ID,
+		Kind:       data.UploadKindProfile,
+		Processing: data.ProcessingReady,
+	})
 	if err != nil {
-		http.Error(w, "Unable to create directory for images", http.StatusInternalServerError)
-		fmt.Println("Error creating directory:", err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	// Save the resized image as WebP
-	err = saveImageAsWebP(resizedImg, "./public/media/user-profile/"+uuid+".webp")
+	err = app.saveImageAsWebP(r.Context(), resizedImg, "user-profile/"+uuid+".webp", 80)
 	if err != nil {
-		http.Error(w, "Unable to save resized image", http.StatusInternalServerError)
-		fmt.Println("Error saving image:", err)
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	err = app.models.Users.UpdateProfilePic(user.ID, (uuid + ".webp"))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	// Return the UUID
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"ghostprotocols.pk/internal/data"
+	"ghostprotocols.pk/internal/imaging"
+	"ghostprotocols.pk/internal/media"
+	"github.com/chai2010/webp"
+	"github.com/google/uuid"
+)
+
+var errImageQueueFull = errors.New("image queue is full")
+
+// imageJob is a gallery upload waiting to be resized and stored. Jobs without a
+// body re-render the renditions of an upload from its stored original.
+type imageJob struct {
+	upload *data.MediaUpload
+	body   []byte
+	mark   *imaging.Watermark
+}
+
+// queueGalleryUploads records a gallery upload for ownerID for each body and
+// queues them to be processed. Either every body is queued or, when the queue
+// cannot take them all, none is and errImageQueueFull is returned. The uploads are
+// recorded first so that the sweeper removes their files if nothing claims them.
+func (app *application) queueGalleryUploads(ownerID int64, bodies [][]byte) ([]*data.MediaUpload, error) {
+	// Refuse early while the queue is already too full, rather than recording
+	// uploads that are bound to fail.
+	if cap(app.images)-len(app.images) < len(bodies) {
+		return nil, errImageQueueFull
+	}
+
+	uploads := make([]*data.MediaUpload, len(bodies))
+	jobs := make([]imageJob, len(bodies))
+
+	for i, body := range bodies {
+		uploads[i] = &data.MediaUpload{
+			ID:         uuid.New().String(),
+			OwnerID:    ownerID,
+			Kind:       data.UploadKindGallery,
+			Processing: data.ProcessingPending,
+		}
+
+		err := app.models.MediaUploads.Insert(uploads[i])
+		if err != nil {
+			for _, upload := range uploads[:i] {
+				app.failImage(upload, err)
+			}
+			return nil, err
+		}
+
+		jobs[i] = imageJob{upload: uploads[i], body: body, mark: app.watermarkFor(nil)}
+	}
+
+	err := app.enqueueImages(jobs)
+	if err != nil {
+		for _, upload := range uploads {
+			app.failImage(upload, err)
+		}
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// queueGalleryUpload is queueGalleryUploads for a single body.
+func (app *application) queueGalleryUpload(ownerID int64, body []byte) (*data.MediaUpload, error) {
+	uploads, err := app.queueGalleryUploads(ownerID, [][]byte{body})
+	if err != nil {
+		return nil, err
+	}
+	return uploads[0], nil
+}
+
+// enqueueImages hands jobs to the image workers without blocking. It fails,
+// queueing none of them, when the queue has no room for all of them so that the
+// handler can ask the client to retry.
+func (app *application) enqueueImages(jobs []imageJob) error {
+	app.imagesMu.Lock()
+	defer app.imagesMu.Unlock()
+
+	// Workers only ever take jobs off the queue, so the room checked here cannot
+	// shrink before the jobs are sent.
+	if cap(app.images)-len(app.images) < len(jobs) {
+		return errImageQueueFull
+	}
+
+	for _, job := range jobs {
+		app.images <- job
+	}
+
+	return nil
+}
+
+func (app *application) startImageWorkers() {
+	for i := 0; i < app.config.media.workers; i++ {
+		app.background(app.imageWorker)
+	}
+}
+
+// imageWorker processes queued images until the server shuts down. Jobs accepted
+// before the HTTP server stopped are finished before it returns.
+func (app *application) imageWorker() {
+	for {
+		select {
+		case job := <-app.images:
+			app.processImage(job)
+		case job := <-app.rerenders:
+			app.processImage(job)
+		case <-app.shutdown:
+			for {
+				select {
+				case job := <-app.images:
+					app.processImage(job)
+				case job := <-app.rerenders:
+					app.processImage(job)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (app *application) processImage(job imageJob) {
+	upload := job.upload
+
+	if job.body == nil {
+		app.rerenderImage(job)
+		return
+	}
+
+	defer func() {
+		if err := recover(); err != nil {
+			app.failImage(upload, fmt.Errorf("%s", err))
+		}
+	}()
+
+	img, err := imaging.Decode(job.body, app.maxUploadPixels())
+	if err != nil {
+		app.failImage(upload, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	err = app.saveImageAsWebP(ctx, img, originalKey(upload.ID), 90)
+	if err != nil {
+		app.failImage(upload, err)
+		return
+	}
+
+	image, err := app.saveGalleryRenditions(ctx, img, upload.ID, job.mark)
+	if err != nil {
+		app.failImage(upload, err)
+		return
+	}
+
+	upload.Processing = data.ProcessingReady
+	upload.Width = image.Width
+	upload.Height = image.Height
+	upload.DHash = imaging.DHash(img)
+
+	err = app.models.MediaUploads.SetProcessed(upload)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"upload_id": upload.ID})
+		return
+	}
+
+	// A listing may have claimed the upload while it was processing, before its
+	// hash was known and without the listing's watermark.
+	if upload.ListingID != 0 {
+		app.flagDuplicatePhotos(upload.ListingID)
+
+		listing, err := app.models.Listings.GetForUpdate(upload.ListingID)
+		if err != nil {
+			app.logger.PrintError(err, map[string]string{"upload_id": upload.ID})
+			return
+		}
+
+		select {
+		case app.rerenders <- imageJob{upload: upload, mark: app.watermarkFor(listing)}:
+		default:
+			app.logger.PrintError(errImageQueueFull, map[string]string{"upload_id": upload.ID})
+		}
+	}
+}
+
+// rerenderImage replaces the renditions of an upload with ones rendered from its
+// original with the job's watermark. Uploads stored before originals were kept
+// are left as they are.
+func (app *application) rerenderImage(job imageJob) {
+	defer func() {
+		if err := recover(); err != nil {
+			app.logger.PrintError(fmt.Errorf("%s", err), map[string]string{"upload_id": job.upload.ID})
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	object, err := app.media.Get(ctx, originalKey(job.upload.ID))
+	if err != nil {
+		if !errors.Is(err, media.ErrNotFound) {
+			app.logger.PrintError(err, map[string]string{"upload_id": job.upload.ID})
+		}
+		return
+	}
+	defer object.Body.Close()
+
+	img, err := webp.Decode(object.Body)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"upload_id": job.upload.ID})
+		return
+	}
+
+	_, err = app.saveGalleryRenditions(ctx, img, job.upload.ID, job.mark)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"upload_id": job.upload.ID})
+	}
+}
+
+// rerenderGallery queues every image of the listing to be re-rendered with the
+// listing's watermark. Only the seller's own processed uploads for the listing are
+// re-rendered, whatever else the stored gallery refers to. It blocks while the
+// queue is full, so it is meant to be run in the background.
+func (app *application) rerenderGallery(listing *data.Listing) {
+	props := map[string]string{"listing_id": strconv.FormatInt(int64(listing.ID), 10)}
+
+	ids := make([]string, 0, len(listing.Gallery))
+
+	for _, image := range listing.Gallery {
+		id, err := uuid.Parse(strings.TrimSuffix(image.Url, ".webp"))
+		if err != nil {
+			app.logger.PrintError(fmt.Errorf("gallery image %q is not an upload", image.Url), props)
+			continue
+		}
+		ids = append(ids, id.String())
+	}
+
+	if len(ids) == 0 {
+		return
+	}
+
+	uploads, err := app.models.MediaUploads.GetGallery(int64(listing.SellerID), int64(listing.ID), ids)
+	if err != nil {
+		app.logger.PrintError(err, props)
+		return
+	}
+
+	mark := app.watermarkFor(listing)
+
+	for _, id := range ids {
+		upload, ok := uploads[id]
+		if !ok || upload.Processing != data.ProcessingReady {
+			continue
+		}
+
+		select {
+		case app.rerenders <- imageJob{upload: upload, mark: mark}:
+		case <-app.shutdown:
+			return
+		}
+	}
+}
+
+// flagDuplicatePhotos records the images of a listing that look like images on
+// other sellers' listings for moderators to review.
+func (app *application) flagDuplicatePhotos(listingID int64) {
+	flagged, err := app.models.DuplicatePhotos.Flag(listingID, app.config.media.duplicateDistance)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"listing_id": strconv.FormatInt(listingID, 10)})
+		return
+	}
+
+	if flagged > 0 {
+		app.logger.PrintInfo("flagged duplicate photos", map[string]string{
+			"listing_id": strconv.FormatInt(listingID, 10),
+			"count":      strconv.FormatInt(flagged, 10),
+		})
+	}
+}
+
+func (app *application) failImage(upload *data.MediaUpload, cause error) {
+	app.logger.PrintError(cause, map[string]string{"upload_id": upload.ID})
+
+	upload.Processing = data.ProcessingFailed
+
+	err := app.models.MediaUploads.SetProcessed(upload)
+	if err != nil {
+		app.logger.PrintError(err, map[string]string{"upload_id": upload.ID})
+	}
+}
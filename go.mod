@@ -13,4 +13,4 @@ require (
 	golang.org/x/time v0.5.0
 )
 
-require github.com/chai2010/webp v1.1.1 // indirect
+require github.com/chai2010/webp v1.1.1
@@ -0,0 +1,154 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// LoginLimits decides how long an identifier is blocked after failed sign ins.
+// The first FreeAttempts failures are not delayed, each one after that doubles
+// the delay starting from BaseDelay, and MaxFailures failures lock the identifier
+// out for Lockout. Failures older than Lockout are forgotten.
+type LoginLimits struct {
+	FreeAttempts int
+	BaseDelay    time.Duration
+	MaxFailures  int
+	Lockout      time.Duration
+}
+
+// Delay returns how long an identifier is blocked after its nth failure in a row.
+func (l LoginLimits) Delay(failures int) time.Duration {
+	switch {
+	case failures >= l.MaxFailures:
+		return l.Lockout
+	case failures <= l.FreeAttempts:
+		return 0
+	}
+
+	delay := l.BaseDelay << (failures - l.FreeAttempts - 1)
+	if delay <= 0 || delay > l.Lockout {
+		return l.Lockout
+	}
+	return delay
+}
+
+// LoginAttempt is the state of an identifier once a sign in has been attempted.
+type LoginAttempt struct {
+	// BlockedFor is set, and nothing else, if the attempt was refused because
+	// the identifier is still blocked.
+	BlockedFor   time.Duration
+	Failures     int
+	BlockedUntil time.Time
+	// LockedOut is set on the attempt that reached LoginLimits.MaxFailures.
+	LockedOut bool
+}
+
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// normalizeIdentifier makes "User@Example.com" and "user@example.com" count
+// against the same identifier.
+func normalizeIdentifier(identifier string) string {
+	return strings.ToLower(strings.TrimSpace(identifier))
+}
+
+// Attempt reserves a sign in for identifier. If the identifier is still blocked
+// it returns how much longer for. Otherwise the attempt is counted as a failure
+// up front and the identifier blocked for as long as limits require, so parallel
+// guesses cannot all get through before any of them is counted; a successful
+// sign in then calls Reset.
+func (m LoginAttemptModel) Attempt(identifier string, limits LoginLimits) (*LoginAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	identifier = normalizeIdentifier(identifier)
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO login_attempts (identifier)
+	VALUES ($1)
+	ON CONFLICT (identifier) DO NOTHING`, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		attempt   LoginAttempt
+		stale     bool
+		blockedMS int64
+	)
+
+	// Locking the row makes attempts at the same identifier wait for each other.
+	err = tx.QueryRowContext(ctx, `
+	SELECT failures,
+	last_failure < NOW() - make_interval(secs => $2),
+	GREATEST(EXTRACT(EPOCH FROM blocked_until - NOW()) * 1000, 0)::BIGINT
+	FROM login_attempts
+	WHERE identifier = $1
+	FOR UPDATE`, identifier, limits.Lockout.Seconds()).Scan(&attempt.Failures, &stale, &blockedMS)
+	if err != nil {
+		return nil, err
+	}
+
+	if blockedMS > 0 {
+		return &LoginAttempt{BlockedFor: time.Duration(blockedMS) * time.Millisecond}, nil
+	}
+
+	if stale {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LockedOut = attempt.Failures == limits.MaxFailures
+
+	err = tx.QueryRowContext(ctx, `
+	UPDATE login_attempts
+	SET failures = $2, last_failure = NOW(), blocked_until = NOW() + make_interval(secs => $3)
+	WHERE identifier = $1
+	RETURNING blocked_until`, identifier, attempt.Failures, limits.Delay(attempt.Failures).Seconds()).Scan(&attempt.BlockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, tx.Commit()
+}
+
+// Reset forgets the failed sign ins of identifier after a successful one.
+func (m LoginAttemptModel) Reset(identifier string) error {
+	query := `
+	DELETE FROM login_attempts
+	WHERE identifier = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, normalizeIdentifier(identifier))
+	return err
+}
+
+// DeleteStale deletes identifiers that last failed and stopped being blocked
+// longer than limits.Lockout ago, whose failures would be forgotten anyway, and
+// returns how many it deleted.
+func (m LoginAttemptModel) DeleteStale(limits LoginLimits) (int64, error) {
+	query := `
+	DELETE FROM login_attempts
+	WHERE last_failure < NOW() - make_interval(secs => $1)
+	AND blocked_until < NOW() - make_interval(secs => $1)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, limits.Lockout.Seconds())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,496 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"ghostprotocols.pk/internal/validator"
+)
+
+// The catalog records below carry the editable columns of the data_* tables, as
+// opposed to Make, Model, Generation and Version which are the shapes shipped to
+// the client apps.
+
+type MakeRecord struct {
+	ID        int32  `json:"id"`
+	Slug      string `json:"url_slug"`
+	Name      string `json:"name"`
+	NameUr    string `json:"name_ur"`
+	Published bool   `json:"published"`
+}
+
+type ModelRecord struct {
+	ID        int32  `json:"id"`
+	MakeID    int32  `json:"make_id"`
+	Slug      string `json:"url_slug"`
+	Name      string `json:"name"`
+	NameUr    string `json:"name_ur"`
+	Popular   bool   `json:"popular"`
+	Published bool   `json:"published"`
+}
+
+type GenerationRecord struct {
+	ID         int32  `json:"id"`
+	ModelID    int32  `json:"model_id"`
+	Slug       string `json:"url_slug"`
+	Name       string `json:"name"`
+	StartYear  int32  `json:"start_year"`
+	EndYear    int32  `json:"end_year"`
+	IsImported bool   `json:"is_imported"`
+	Published  bool   `json:"published"`
+}
+
+type VersionRecord struct {
+	ID         int32  `json:"id"`
+	ModelID    int32  `json:"model_id"`
+	GenID      int32  `json:"gen_id"`
+	Slug       string `json:"url_slug"`
+	Name       string `json:"name"`
+	NameUr     string `json:"name_ur"`
+	IsPopular  bool   `json:"is_popular"`
+	IsImported bool   `json:"is_imported"`
+	Published  bool   `json:"published"`
+}
+
+var ErrDuplicateSlug = errors.New("this url slug already exists")
+
+// catalogTables maps a catalog kind to its table and the name of its published
+// column. Only these values are ever interpolated into SQL.
+var catalogTables = map[string]struct {
+	table     string
+	published string
+}{
+	"makes":       {"data_makes", "published"},
+	"models":      {"data_models", "published"},
+	"generations": {"data_generations", "published"},
+	"versions":    {"data_versions", "is_published"},
+}
+
+func ValidateSlug(v *validator.Validator, slug string) {
+	v.Check(slug != "", "url_slug", "must be provided")
+	v.Check(len(slug) <= 200, "url_slug", "must not be more than 200 bytes long")
+	v.Check(validator.Matches(slug, validator.SlugRX), "url_slug", "must only contain lowercase letters, digits and hyphens")
+}
+
+func ValidateMakeRecord(v *validator.Validator, record *MakeRecord) {
+	ValidateSlug(v, record.Slug)
+	v.Check(record.Name != "", "name", "must be provided")
+	v.Check(len(record.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(len(record.NameUr) <= 255, "name_ur", "must not be more than 255 bytes long")
+}
+
+func ValidateModelRecord(v *validator.Validator, model *ModelRecord) {
+	ValidateSlug(v, model.Slug)
+	v.Check(model.MakeID != 0, "make_id", "must be provided")
+	v.Check(model.Name != "", "name", "must be provided")
+	v.Check(len(model.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(len(model.NameUr) <= 255, "name_ur", "must not be more than 255 bytes long")
+}
+
+func ValidateGenerationRecord(v *validator.Validator, generation *GenerationRecord) {
+	ValidateSlug(v, generation.Slug)
+	v.Check(generation.ModelID != 0, "model_id", "must be provided")
+	v.Check(len(generation.Name) <= 100, "name", "must not be more than 100 bytes long")
+	// data_generations only accepts start years from 1941 to 2024.
+	v.Check(generation.StartYear > 1940, "start_year", "must be greater than 1940")
+	v.Check(generation.StartYear < 2025, "start_year", "must be less than 2025")
+	// An end_year of 0 means the generation is still in production.
+	if generation.EndYear != 0 {
+		v.Check(generation.EndYear >= 1000 && generation.EndYear <= 9999, "end_year", "must be a four digit year")
+		v.Check(generation.StartYear <= generation.EndYear, "end_year", "must not be before start_year")
+	}
+}
+
+func ValidateVersionRecord(v *validator.Validator, version *VersionRecord) {
+	ValidateSlug(v, version.Slug)
+	v.Check(version.ModelID != 0, "model_id", "must be provided")
+	v.Check(version.GenID != 0, "gen_id", "must be provided")
+	v.Check(version.Name != "", "name", "must be provided")
+	v.Check(len(version.Name) <= 255, "name", "must not be more than 255 bytes long")
+	v.Check(len(version.NameUr) <= 255, "name_ur", "must not be more than 255 bytes long")
+}
+
+func catalogWriteError(err error) error {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return ErrRecordNotFound
+	case strings.HasPrefix(err.Error(), `pq: duplicate key value violates unique constraint "idx_data_`) &&
+		strings.HasSuffix(err.Error(), `_url_slug_unique"`):
+		return ErrDuplicateSlug
+	default:
+		return err
+	}
+}
+
+func (m *DataModel) GetMakeRecord(id int32) (*MakeRecord, error) {
+	query := `
+	SELECT id, url_slug, name, COALESCE(name_ur, ''), COALESCE(published, true)
+	FROM data_makes
+	WHERE id = $1 AND deleted = false;
+	`
+
+	var record MakeRecord
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&record.ID,
+		&record.Slug,
+		&record.Name,
+		&record.NameUr,
+		&record.Published,
+	)
+	if err != nil {
+		return nil, catalogWriteError(err)
+	}
+
+	return &record, nil
+}
+
+func (m *DataModel) InsertMake(record *MakeRecord) error {
+	query := `
+	INSERT INTO data_makes (url_slug, name, name_ur, published)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id;
+	`
+
+	args := []any{record.Slug, record.Name, record.NameUr, record.Published}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&record.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) UpdateMake(record *MakeRecord) error {
+	query := `
+	UPDATE data_makes
+	SET url_slug = $1, name = $2, name_ur = $3, published = $4
+	WHERE id = $5 AND deleted = false
+	RETURNING id;
+	`
+
+	args := []any{record.Slug, record.Name, record.NameUr, record.Published, record.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&record.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) GetModelRecord(id int32) (*ModelRecord, error) {
+	query := `
+	SELECT id, make_id, url_slug, name, COALESCE(name_ur, ''),
+	COALESCE(popular, false), COALESCE(published, true)
+	FROM data_models
+	WHERE id = $1 AND deleted = false;
+	`
+
+	var model ModelRecord
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&model.ID,
+		&model.MakeID,
+		&model.Slug,
+		&model.Name,
+		&model.NameUr,
+		&model.Popular,
+		&model.Published,
+	)
+	if err != nil {
+		return nil, catalogWriteError(err)
+	}
+
+	return &model, nil
+}
+
+func (m *DataModel) InsertModel(model *ModelRecord) error {
+	query := `
+	INSERT INTO data_models (make_id, url_slug, name, name_ur, popular, published, active)
+	VALUES ($1, $2, $3, $4, $5, $6, true)
+	RETURNING id;
+	`
+
+	args := []any{model.MakeID, model.Slug, model.Name, model.NameUr, model.Popular, model.Published}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&model.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) UpdateModel(model *ModelRecord) error {
+	query := `
+	UPDATE data_models
+	SET make_id = $1, url_slug = $2, name = $3, name_ur = $4, popular = $5, published = $6
+	WHERE id = $7 AND deleted = false
+	RETURNING id;
+	`
+
+	args := []any{model.MakeID, model.Slug, model.Name, model.NameUr, model.Popular, model.Published, model.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&model.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) GetGenerationRecord(id int32) (*GenerationRecord, error) {
+	query := `
+	SELECT id, model_id, url_slug, COALESCE(name, ''), start_year, end_year,
+	COALESCE(is_imported, false), COALESCE(published, true)
+	FROM data_generations
+	WHERE id = $1 AND deleted = false;
+	`
+
+	var (
+		generation GenerationRecord
+		endYear    sql.NullString
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&generation.ID,
+		&generation.ModelID,
+		&generation.Slug,
+		&generation.Name,
+		&generation.StartYear,
+		&endYear,
+		&generation.IsImported,
+		&generation.Published,
+	)
+	if err != nil {
+		return nil, catalogWriteError(err)
+	}
+
+	// end_year is stored as CHAR(4), and is NULL or blank while the generation is
+	// still in production.
+	if year := strings.TrimSpace(endYear.String); year != "" {
+		end, err := strconv.Atoi(year)
+		if err != nil {
+			return nil, err
+		}
+		generation.EndYear = int32(end)
+	}
+
+	return &generation, nil
+}
+
+// generationEndYear returns end_year as stored, NULL for a generation that is still
+// in production.
+func generationEndYear(generation *GenerationRecord) any {
+	if generation.EndYear == 0 {
+		return nil
+	}
+	return strconv.Itoa(int(generation.EndYear))
+}
+
+func (m *DataModel) InsertGeneration(generation *GenerationRecord) error {
+	query := `
+	INSERT INTO data_generations (model_id, url_slug, name, start_year, end_year, is_imported, published)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	RETURNING id;
+	`
+
+	args := []any{
+		generation.ModelID,
+		generation.Slug,
+		generation.Name,
+		generation.StartYear,
+		generationEndYear(generation),
+		generation.IsImported,
+		generation.Published,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&generation.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) UpdateGeneration(generation *GenerationRecord) error {
+	query := `
+	UPDATE data_generations
+	SET model_id = $1, url_slug = $2, name = $3, start_year = $4, end_year = $5,
+	is_imported = $6, published = $7
+	WHERE id = $8 AND deleted = false
+	RETURNING id;
+	`
+
+	args := []any{
+		generation.ModelID,
+		generation.Slug,
+		generation.Name,
+		generation.StartYear,
+		generationEndYear(generation),
+		generation.IsImported,
+		generation.Published,
+		generation.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&generation.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) GetVersionRecord(id int32) (*VersionRecord, error) {
+	query := `
+	SELECT id, model_id, gen_id, url_slug, name, COALESCE(name_ur, ''),
+	COALESCE(is_popular, false), COALESCE(is_imported, false), COALESCE(is_published, true)
+	FROM data_versions
+	WHERE id = $1 AND deleted = false;
+	`
+
+	var version VersionRecord
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&version.ID,
+		&version.ModelID,
+		&version.GenID,
+		&version.Slug,
+		&version.Name,
+		&version.NameUr,
+		&version.IsPopular,
+		&version.IsImported,
+		&version.Published,
+	)
+	if err != nil {
+		return nil, catalogWriteError(err)
+	}
+
+	return &version, nil
+}
+
+func (m *DataModel) InsertVersion(version *VersionRecord) error {
+	query := `
+	INSERT INTO data_versions (model_id, gen_id, url_slug, name, name_ur,
+	is_popular, is_imported, is_published, is_active)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true)
+	RETURNING id;
+	`
+
+	args := []any{
+		version.ModelID,
+		version.GenID,
+		version.Slug,
+		version.Name,
+		version.NameUr,
+		version.IsPopular,
+		version.IsImported,
+		version.Published,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&version.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+func (m *DataModel) UpdateVersion(version *VersionRecord) error {
+	query := `
+	UPDATE data_versions
+	SET model_id = $1, gen_id = $2, url_slug = $3, name = $4, name_ur = $5,
+	is_popular = $6, is_imported = $7, is_published = $8
+	WHERE id = $9 AND deleted = false
+	RETURNING id;
+	`
+
+	args := []any{
+		version.ModelID,
+		version.GenID,
+		version.Slug,
+		version.Name,
+		version.NameUr,
+		version.IsPopular,
+		version.IsImported,
+		version.Published,
+		version.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&version.ID)
+	if err != nil {
+		return catalogWriteError(err)
+	}
+
+	return nil
+}
+
+// SetPublished publishes or unpublishes a make, model, generation or version.
+func (m *DataModel) SetPublished(kind string, id int32, published bool) error {
+	t, ok := catalogTables[kind]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	query := `UPDATE ` + t.table + ` SET ` + t.published + ` = $1 WHERE id = $2 AND deleted = false;`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, published, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
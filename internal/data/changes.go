@@ -0,0 +1,181 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// ChangeSet holds the rows of one catalog kind that were inserted or updated since
+// a cursor, and the IDs of the rows that were deleted or unpublished.
+type ChangeSet[T any] struct {
+	Upserted []*T    `json:"upserted"`
+	Deleted  []int32 `json:"deleted"`
+}
+
+type CatalogChanges struct {
+	Cursor      int64                 `json:"cursor"`
+	Makes       ChangeSet[Make]       `json:"makes"`
+	Models      ChangeSet[Model]      `json:"models"`
+	Generations ChangeSet[Generation] `json:"generations"`
+	Versions    ChangeSet[Version]    `json:"versions"`
+	Colors      ChangeSet[Color]      `json:"colors"`
+}
+
+// GetChanges returns every tracked catalog row changed after the since cursor,
+// read from a single snapshot. The returned cursor is the highest change seen and
+// should be passed as since on the next call. Catalog writers take change_seq
+// values in commit order (see the stamp_catalog_change trigger), so no change
+// below the cursor can become visible later.
+func (m *DataModel) GetChanges(since int64) (*CatalogChanges, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	changes := &CatalogChanges{Cursor: since}
+
+	query := `
+	SELECT id, name, COALESCE(name_ur, ''), deleted OR published IS FALSE, change_seq
+	FROM data_makes
+	WHERE change_seq > $1
+	ORDER BY change_seq;
+	`
+	err = scanChanges(ctx, tx, query, since, &changes.Makes, &changes.Cursor, func(rows *sql.Rows, record *Make, deleted *bool, seq *int64) error {
+		return rows.Scan(&record.ID, &record.Name, &record.NameUr, deleted, seq)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, name, COALESCE(name_ur, ''), make_id, deleted OR published IS FALSE, change_seq
+	FROM data_models
+	WHERE change_seq > $1
+	ORDER BY change_seq;
+	`
+	err = scanChanges(ctx, tx, query, since, &changes.Models, &changes.Cursor, func(rows *sql.Rows, model *Model, deleted *bool, seq *int64) error {
+		return rows.Scan(&model.ID, &model.Name, &model.NameUr, &model.MakeID, deleted, seq)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, start_year, COALESCE(NULLIF(TRIM(end_year), '')::INT, 0), model_id,
+	deleted OR published IS FALSE, change_seq
+	FROM data_generations
+	WHERE change_seq > $1
+	ORDER BY change_seq;
+	`
+	err = scanChanges(ctx, tx, query, since, &changes.Generations, &changes.Cursor, func(rows *sql.Rows, generation *Generation, deleted *bool, seq *int64) error {
+		return rows.Scan(&generation.ID, &generation.StartYear, &generation.EndYear, &generation.ModelID, deleted, seq)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT data_versions.id, data_versions.gen_id, data_versions.model_id,
+	data_versions.name, COALESCE(data_versions.name_ur, ''),
+	COALESCE(data_details.transmission_type, 0), COALESCE(data_details.fuel_type, 0),
+	COALESCE(data_details.engine_capacity, 0),
+	data_versions.deleted OR data_versions.is_published IS FALSE, data_versions.change_seq
+	FROM data_versions
+	LEFT JOIN data_details ON data_details.version_id = data_versions.id
+	WHERE data_versions.change_seq > $1
+	ORDER BY data_versions.change_seq;
+	`
+	err = scanChanges(ctx, tx, query, since, &changes.Versions, &changes.Cursor, func(rows *sql.Rows, version *Version, deleted *bool, seq *int64) error {
+		return rows.Scan(
+			&version.ID,
+			&version.GenID,
+			&version.ModelID,
+			&version.Name,
+			&version.NameUr,
+			&version.Transmission,
+			&version.FuelType,
+			&version.EngineCapacity,
+			deleted,
+			seq,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+	SELECT id, COALESCE(name, ''), COALESCE(name_ur, ''), COALESCE(hex_code, ''), deleted, change_seq
+	FROM data_colors
+	WHERE version_id IS NULL AND change_seq > $1
+	ORDER BY change_seq;
+	`
+	err = scanChanges(ctx, tx, query, since, &changes.Colors, &changes.Cursor, func(rows *sql.Rows, color *Color, deleted *bool, seq *int64) error {
+		return rows.Scan(&color.ID, &color.Name, &color.NameUr, &color.HexCode, deleted, seq)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, tx.Commit()
+}
+
+// scanChanges runs a change query and sorts each row into the upserted or deleted
+// half of set, advancing cursor past every change it sees.
+func scanChanges[T any](ctx context.Context, q queryer, query string, since int64, set *ChangeSet[T], cursor *int64, scan func(rows *sql.Rows, row *T, deleted *bool, seq *int64) error) error {
+	rows, err := q.QueryContext(ctx, query, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	set.Upserted = []*T{}
+	set.Deleted = []int32{}
+
+	for rows.Next() {
+		var (
+			row     T
+			deleted bool
+			seq     int64
+		)
+
+		err := scan(rows, &row, &deleted, &seq)
+		if err != nil {
+			return err
+		}
+
+		if seq > *cursor {
+			*cursor = seq
+		}
+
+		if deleted {
+			set.Deleted = append(set.Deleted, rowID(&row))
+			continue
+		}
+
+		set.Upserted = append(set.Upserted, &row)
+	}
+
+	return rows.Err()
+}
+
+func rowID(row any) int32 {
+	switch row := row.(type) {
+	case *Make:
+		return row.ID
+	case *Model:
+		return row.ID
+	case *Generation:
+		return row.ID
+	case *Version:
+		return row.ID
+	case *Color:
+		return row.ID
+	default:
+		panic("unsupported catalog row type")
+	}
+}
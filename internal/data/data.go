@@ -11,6 +11,12 @@ type DataModel struct {
 	DB *sql.DB
 }
 
+// queryer is satisfied by both *sql.DB and *sql.Tx so that the catalog queries can
+// run on their own or inside a snapshot transaction.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
 type Color struct {
 	ID      int32  `json:"id"`
 	Name    string `json:"name"`
@@ -72,7 +78,7 @@ type Details struct {
 }
 
 type City struct {
-	ID      int32  `json:"version_id"`
+	ID      int32  `json:"id"`
 	Name    string `json:"name"`
 	NameUr  string `json:"name_ur"`
 	Popular bool   `json:"popular"`
@@ -93,14 +99,20 @@ type Registration struct {
 }
 
 func (m *DataModel) GetMakes() ([]*Make, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getMakes(ctx, m.DB)
+}
+
+func getMakes(ctx context.Context, q queryer) ([]*Make, error) {
 	query := `
 	SELECT id, name, name_ur  
-	FROM data_makes; 
+	FROM data_makes
+	WHERE deleted = false AND published IS NOT FALSE;
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -129,14 +141,20 @@ func (m *DataModel) GetMakes() ([]*Make, error) {
 }
 
 func (m *DataModel) GetModels() ([]*Model, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getModels(ctx, m.DB)
+}
+
+func getModels(ctx context.Context, q queryer) ([]*Model, error) {
 	query := `
 	SELECT id, name, name_ur, make_id  
-	FROM data_models;  
+	FROM data_models
+	WHERE deleted = false AND published IS NOT FALSE;
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -166,14 +184,20 @@ func (m *DataModel) GetModels() ([]*Model, error) {
 }
 
 func (m *DataModel) GetGenerations() ([]*Generation, error) {
-	query := `
-	SELECT id, start_year, end_year, model_id
-	FROM data_generations;
-	`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	return getGenerations(ctx, m.DB)
+}
+
+func getGenerations(ctx context.Context, q queryer) ([]*Generation, error) {
+	query := `
+	SELECT id, start_year, COALESCE(NULLIF(TRIM(end_year), '')::INT, 0), model_id
+	FROM data_generations
+	WHERE deleted = false AND published IS NOT FALSE;
+	`
+
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -203,17 +227,23 @@ func (m *DataModel) GetGenerations() ([]*Generation, error) {
 }
 
 func (m *DataModel) GetVersions() ([]*Version, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getVersions(ctx, m.DB)
+}
+
+func getVersions(ctx context.Context, q queryer) ([]*Version, error) {
 	query := `
 	SELECT data_versions.id, data_versions.gen_id, data_versions.model_id,
 	 data_versions.name, data_versions.name_ur, 
 	 data_details.transmission_type, data_details.fuel_type,
 	data_details.engine_capacity FROM data_versions Left
-	 JOIN data_details ON data_details.version_id = data_versions.id;
+	 JOIN data_details ON data_details.version_id = data_versions.id
+	WHERE data_versions.deleted = false AND data_versions.is_published IS NOT FALSE;
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -241,8 +271,6 @@ func (m *DataModel) GetVersions() ([]*Version, error) {
 			return nil, err
 		}
 
-		fmt.Println(tranmission, fueltype, engineCapacity)
-
 		if tranmission.Valid {
 			version.Transmission = tranmission.Int16
 		} else {
@@ -271,15 +299,20 @@ func (m *DataModel) GetVersions() ([]*Version, error) {
 }
 
 func (m *DataModel) GetColors() ([]*Color, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getColors(ctx, m.DB)
+}
+
+func getColors(ctx context.Context, q queryer) ([]*Color, error) {
 	query := `
 	SELECT id, name, name_ur, hex_code 
 	FROM data_colors 
-	WHERE version_id IS NULL;
+	WHERE version_id IS NULL AND deleted = false;
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -309,14 +342,19 @@ func (m *DataModel) GetColors() ([]*Color, error) {
 }
 
 func (m *DataModel) GetTransmissions() ([]*Transmission, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getTransmissions(ctx, m.DB)
+}
+
+func getTransmissions(ctx context.Context, q queryer) ([]*Transmission, error) {
 	query := `
 	SELECT id, name
 	FROM data_transmissions ;
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -344,14 +382,19 @@ func (m *DataModel) GetTransmissions() ([]*Transmission, error) {
 }
 
 func (m *DataModel) GetBodyTypes() ([]*BodyType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getBodyTypes(ctx, m.DB)
+}
+
+func getBodyTypes(ctx context.Context, q queryer) ([]*BodyType, error) {
 	query := `
 	SELECT id, name
 	FROM data_body_types ; 
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -379,14 +422,19 @@ func (m *DataModel) GetBodyTypes() ([]*BodyType, error) {
 }
 
 func (m *DataModel) GetFuelTypes() ([]*FuelType, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getFuelTypes(ctx, m.DB)
+}
+
+func getFuelTypes(ctx context.Context, q queryer) ([]*FuelType, error) {
 	query := `
 	SELECT id, name
 	FROM fuel_types ; 
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -414,14 +462,19 @@ func (m *DataModel) GetFuelTypes() ([]*FuelType, error) {
 }
 
 func (m *DataModel) GetCities() ([]*City, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getCities(ctx, m.DB)
+}
+
+func getCities(ctx context.Context, q queryer) ([]*City, error) {
 	query := `
 	SELECT id, name, name_ur, popular  
 	FROM cities; 
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -451,14 +504,19 @@ func (m *DataModel) GetCities() ([]*City, error) {
 }
 
 func (m *DataModel) GetAreas() ([]*Area, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getAreas(ctx, m.DB)
+}
+
+func getAreas(ctx context.Context, q queryer) ([]*Area, error) {
 	query := `
 	SELECT id, name, name_ur, city  
 	FROM areas; 
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -488,14 +546,19 @@ func (m *DataModel) GetAreas() ([]*Area, error) {
 }
 
 func (m *DataModel) GetRegistrations() ([]*Registration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return getRegistrations(ctx, m.DB)
+}
+
+func getRegistrations(ctx context.Context, q queryer) ([]*Registration, error) {
 	query := `
 	SELECT id, name, name_ur, type  
 	FROM registrations; 
 	`
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query)
+	rows, err := q.QueryContext(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("error querying database: %w", err)
 	}
@@ -523,3 +586,69 @@ func (m *DataModel) GetRegistrations() ([]*Registration, error) {
 
 	return registrations, nil
 }
+
+// Catalog holds every catalog table read from a single consistent snapshot.
+type Catalog struct {
+	Makes         []*Make
+	Models        []*Model
+	Generations   []*Generation
+	Versions      []*Version
+	Colors        []*Color
+	Transmissions []*Transmission
+	BodyTypes     []*BodyType
+	FuelTypes     []*FuelType
+	Cities        []*City
+	Areas         []*Area
+	Registrations []*Registration
+}
+
+// GetCatalog reads every catalog table inside one read-only repeatable read
+// transaction, so the exported files never mix rows from different points in time.
+func (m *DataModel) GetCatalog() (*Catalog, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var c Catalog
+
+	if c.Makes, err = getMakes(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Models, err = getModels(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Generations, err = getGenerations(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Versions, err = getVersions(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Colors, err = getColors(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Transmissions, err = getTransmissions(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.BodyTypes, err = getBodyTypes(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.FuelTypes, err = getFuelTypes(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Cities, err = getCities(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Areas, err = getAreas(ctx, tx); err != nil {
+		return nil, err
+	}
+	if c.Registrations, err = getRegistrations(ctx, tx); err != nil {
+		return nil, err
+	}
+
+	return &c, tx.Commit()
+}
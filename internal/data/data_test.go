@@ -0,0 +1,76 @@
+package data
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to the migrated database in GHOSTPROTOCOLS_TEST_DB_DSN,
+// skipping the test if it is not set.
+func openTestDB(t *testing.T) *sql.DB {
+	dsn := os.Getenv("GHOSTPROTOCOLS_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("GHOSTPROTOCOLS_TEST_DB_DSN is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	err = db.Ping()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func TestGetGenerationsStillInProduction(t *testing.T) {
+	db := openTestDB(t)
+	m := &DataModel{DB: db}
+	slug := fmt.Sprintf("test-%d", time.Now().UnixNano())
+
+	makeRecord := &MakeRecord{Slug: slug, Name: "Test make", Published: true}
+	err := m.InsertMake(makeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		// Models and generations go with the make.
+		db.Exec(`DELETE FROM data_makes WHERE id = $1`, makeRecord.ID)
+	})
+
+	model := &ModelRecord{MakeID: makeRecord.ID, Slug: slug, Name: "Test model", Published: true}
+	err = m.InsertModel(model)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generation := &GenerationRecord{ModelID: model.ID, Slug: slug, Name: "Test generation", StartYear: 2020, Published: true}
+	err = m.InsertGeneration(generation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	generations, err := m.GetGenerations()
+	if err != nil {
+		t.Fatalf("GetGenerations: %v", err)
+	}
+
+	for _, g := range generations {
+		if g.ID == generation.ID {
+			if g.StartYear != 2020 || g.EndYear != 0 {
+				t.Errorf("got years %d-%d, want 2020-0", g.StartYear, g.EndYear)
+			}
+			return
+		}
+	}
+	t.Errorf("generation %d not listed", generation.ID)
+}
@@ -0,0 +1,107 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DuplicatePhoto is an image of a listing whose perceptual hash is within a few
+// bits of an image on another seller's listing.
+type DuplicatePhoto struct {
+	ID               int64     `json:"id"`
+	ListingID        int64     `json:"listing_id"`
+	SellerID         int64     `json:"seller_id"`
+	Url              string    `json:"url"`
+	MatchedListingID int64     `json:"matched_listing_id"`
+	MatchedSellerID  int64     `json:"matched_seller_id"`
+	MatchedUrl       string    `json:"matched_url"`
+	Distance         int       `json:"distance"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+type DuplicatePhotoModel struct {
+	DB *sql.DB
+}
+
+// Flag records every image of the listing that is at most maxDistance bits from
+// an image another seller has used on one of their listings, and returns how many
+// new matches were found.
+func (m DuplicatePhotoModel) Flag(listingID int64, maxDistance int) (int64, error) {
+	query := `
+	INSERT INTO duplicate_photos (listing_id, upload_id, matched_listing_id, matched_upload_id, distance)
+	SELECT u.listing_id, u.id, o.listing_id, o.id, hamming_distance(u.dhash, o.dhash)
+	FROM media_uploads u
+	JOIN media_uploads o ON o.kind = 'gallery' AND o.status = 'claimed'
+		AND o.owner_id <> u.owner_id AND o.listing_id IS NOT NULL AND o.dhash IS NOT NULL
+	WHERE u.listing_id = $1 AND u.kind = 'gallery' AND u.status = 'claimed' AND u.dhash IS NOT NULL
+	AND hamming_distance(u.dhash, o.dhash) <= $2
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, listingID, maxDistance)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetAll returns the flagged images, newest first. A listingID of zero returns the
+// flags of every listing.
+func (m DuplicatePhotoModel) GetAll(listingID int64, s Sorting) ([]*DuplicatePhoto, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), d.id,
+	d.listing_id, COALESCE(l.seller, 0), d.upload_id::TEXT || '.webp',
+	d.matched_listing_id, COALESCE(ml.seller, 0), d.matched_upload_id::TEXT || '.webp',
+	d.distance, d.created_at
+	FROM duplicate_photos d
+	JOIN listings l ON d.listing_id = l.id
+	JOIN listings ml ON d.matched_listing_id = ml.id
+	WHERE (d.listing_id = $1 OR $1 = 0)
+	ORDER BY d.created_at DESC, d.id DESC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, listingID, s.limit(), s.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	duplicates := []*DuplicatePhoto{}
+
+	for rows.Next() {
+		var duplicate DuplicatePhoto
+
+		err := rows.Scan(
+			&totalRecords,
+			&duplicate.ID,
+			&duplicate.ListingID,
+			&duplicate.SellerID,
+			&duplicate.Url,
+			&duplicate.MatchedListingID,
+			&duplicate.MatchedSellerID,
+			&duplicate.MatchedUrl,
+			&duplicate.Distance,
+			&duplicate.CreatedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		duplicates = append(duplicates, &duplicate)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, s.Page, s.PageSize)
+
+	return duplicates, metadata, nil
+}
@@ -0,0 +1,559 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"ghostprotocols.pk/internal/validator"
+)
+
+// ImportBatch holds catalog rows keyed by kind. Every row is a map of column to
+// value as text, and is identified by its pk_id. Parents are referenced by their
+// pk_id too, e.g. a model row carries make_pk_id rather than make_id.
+type ImportBatch map[string][]map[string]string
+
+type importParent struct {
+	field    string // input field holding the parent's pk_id, e.g. make_pk_id
+	column   string // column holding the parent's id, e.g. make_id
+	table    string
+	required bool
+}
+
+type importKind struct {
+	name     string
+	table    string
+	columns  []string
+	required []string
+	parents  []importParent
+}
+
+// importKinds lists what can be imported, in the order it has to be applied so
+// that parents exist before their children. Only these table and column names are
+// ever interpolated into SQL.
+var importKinds = []importKind{
+	{
+		name:     "makes",
+		table:    "data_makes",
+		columns:  []string{"url_slug", "name", "name_ur", "published"},
+		required: []string{"url_slug", "name"},
+	},
+	{
+		name:     "models",
+		table:    "data_models",
+		columns:  []string{"url_slug", "name", "name_ur", "active", "published", "popular"},
+		required: []string{"url_slug", "name"},
+		parents:  []importParent{{"make_pk_id", "make_id", "data_makes", true}},
+	},
+	{
+		name:     "generations",
+		table:    "data_generations",
+		columns:  []string{"url_slug", "name", "start_year", "end_year", "is_imported", "published"},
+		required: []string{"url_slug", "start_year"},
+		parents:  []importParent{{"model_pk_id", "model_id", "data_models", true}},
+	},
+	{
+		name:     "versions",
+		table:    "data_versions",
+		columns:  []string{"url_slug", "name", "name_ur", "is_active", "is_popular", "is_published", "is_imported"},
+		required: []string{"url_slug", "name"},
+		parents: []importParent{
+			{"model_pk_id", "model_id", "data_models", true},
+			{"gen_pk_id", "gen_id", "data_generations", true},
+		},
+	},
+	{
+		name:    "colors",
+		table:   "data_colors",
+		columns: []string{"name", "name_ur", "hex_code", "mapped_name"},
+		parents: []importParent{{"version_pk_id", "version_id", "data_versions", false}},
+	},
+	{
+		name:     "cities",
+		table:    "cities",
+		columns:  []string{"name", "name_ur", "popular"},
+		required: []string{"name"},
+	},
+	{
+		name:     "areas",
+		table:    "areas",
+		columns:  []string{"name", "name_ur", "popular", "url_slug", "zone"},
+		required: []string{"name", "name_ur"},
+		parents:  []importParent{{"city_pk_id", "city", "cities", true}},
+	},
+}
+
+func lookupImportKind(name string) (importKind, bool) {
+	for _, kind := range importKinds {
+		if kind.name == name {
+			return kind, true
+		}
+	}
+	return importKind{}, false
+}
+
+// ParseImportJSON reads a batch from a JSON object whose keys are kinds and whose
+// values are arrays of rows.
+func ParseImportJSON(r io.Reader) (ImportBatch, error) {
+	var raw map[string][]map[string]any
+
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+
+	err := dec.Decode(&raw)
+	if err != nil {
+		return nil, fmt.Errorf("body contains badly-formed JSON: %w", err)
+	}
+
+	batch := ImportBatch{}
+
+	for kind, rows := range raw {
+		for i, row := range rows {
+			converted := map[string]string{}
+
+			for field, value := range row {
+				switch value := value.(type) {
+				case nil:
+					converted[field] = ""
+				case string:
+					converted[field] = value
+				case json.Number:
+					converted[field] = value.String()
+				case bool:
+					converted[field] = strconv.FormatBool(value)
+				default:
+					return nil, fmt.Errorf("%s[%d].%s must be a string, number or boolean", kind, i, field)
+				}
+			}
+
+			batch[kind] = append(batch[kind], converted)
+		}
+	}
+
+	return batch, nil
+}
+
+// ParseImportCSV reads rows of a single kind from CSV with a header row naming the
+// fields.
+func ParseImportCSV(kind string, r io.Reader) (ImportBatch, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("csv must have a header row")
+		}
+		return nil, err
+	}
+
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+
+	batch := ImportBatch{kind: {}}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := map[string]string{}
+		for i, field := range header {
+			row[field] = record[i]
+		}
+
+		batch[kind] = append(batch[kind], row)
+	}
+
+	return batch, nil
+}
+
+func ValidateImportBatch(v *validator.Validator, batch ImportBatch) {
+	v.Check(len(batch) > 0, "import", "must contain at least one kind")
+
+	for name, rows := range batch {
+		kind, ok := lookupImportKind(name)
+		if !ok {
+			v.AddError(name, "is not an importable kind")
+			continue
+		}
+
+		known := map[string]bool{"pk_id": true}
+		for _, column := range kind.columns {
+			known[column] = true
+		}
+		for _, parent := range kind.parents {
+			known[parent.field] = true
+		}
+
+		seen := map[string]bool{}
+
+		for i, row := range rows {
+			key := fmt.Sprintf("%s[%d]", name, i)
+
+			for field := range row {
+				v.Check(known[field], key+"."+field, "is not a known field")
+			}
+
+			_, err := strconv.ParseInt(row["pk_id"], 10, 32)
+			v.Check(err == nil, key+".pk_id", "must be an integer")
+			v.Check(!seen[row["pk_id"]], key+".pk_id", "must be unique within the import")
+			seen[row["pk_id"]] = true
+
+			for _, field := range kind.required {
+				v.Check(row[field] != "", key+"."+field, "must be provided")
+			}
+
+			for _, parent := range kind.parents {
+				if row[parent.field] == "" {
+					v.Check(!parent.required, key+"."+parent.field, "must be provided")
+					continue
+				}
+				_, err := strconv.ParseInt(row[parent.field], 10, 32)
+				v.Check(err == nil, key+"."+parent.field, "must be an integer")
+			}
+
+			if slug, ok := row["url_slug"]; ok && slug != "" {
+				v.Check(validator.Matches(slug, validator.SlugRX), key+".url_slug", "must only contain lowercase letters, digits and hyphens")
+			}
+
+			if name == "generations" {
+				// A blank end_year is stored as NULL, for a generation still in production.
+				if end := strings.TrimSpace(row["end_year"]); end != "" {
+					endYear, err := strconv.Atoi(end)
+					v.Check(err == nil && endYear >= 1000 && endYear <= 9999, key+".end_year", "must be a four digit year")
+
+					startYear, errStart := strconv.Atoi(row["start_year"])
+					if err == nil && errStart == nil {
+						v.Check(startYear <= endYear, key+".end_year", "must not be before start_year")
+					}
+				}
+			}
+		}
+	}
+}
+
+// ImportChange describes one row an import inserted or updated. Fields maps each
+// changed column to its old and new value.
+type ImportChange struct {
+	Kind   string               `json:"kind"`
+	Action string               `json:"action"`
+	PkID   string               `json:"pk_id"`
+	Fields map[string][2]string `json:"fields"`
+}
+
+type ImportReport struct {
+	DryRun    bool           `json:"dry_run"`
+	Changes   []ImportChange `json:"changes"`
+	Unchanged map[string]int `json:"unchanged"`
+}
+
+// WriteDiff writes the report as a human readable diff, one line per changed
+// field.
+func (r *ImportReport) WriteDiff(w io.Writer) error {
+	for _, change := range r.Changes {
+		sign := "~"
+		if change.Action == "insert" {
+			sign = "+"
+		}
+
+		_, err := fmt.Fprintf(w, "%s %s pk_id=%s\n", sign, change.Kind, change.PkID)
+		if err != nil {
+			return err
+		}
+
+		fields := make([]string, 0, len(change.Fields))
+		for field := range change.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+
+		for _, field := range fields {
+			values := change.Fields[field]
+			if change.Action == "insert" {
+				_, err = fmt.Fprintf(w, "    %s: %q\n", field, values[1])
+			} else {
+				_, err = fmt.Fprintf(w, "    %s: %q -> %q\n", field, values[0], values[1])
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, kind := range importKinds {
+		if n := r.Unchanged[kind.name]; n > 0 {
+			_, err := fmt.Fprintf(w, "  %s: %d unchanged\n", kind.name, n)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Import upserts every row of batch by pk_id inside a single transaction. With
+// dryRun the transaction is rolled back, so the report shows what would change.
+func (m *DataModel) Import(batch ImportBatch, dryRun bool) (*ImportReport, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	report := &ImportReport{
+		DryRun:    dryRun,
+		Changes:   []ImportChange{},
+		Unchanged: map[string]int{},
+	}
+
+	for _, kind := range importKinds {
+		for i, row := range batch[kind.name] {
+			change, err := importRow(ctx, tx, kind, row)
+			if err != nil {
+				return nil, fmt.Errorf("%s[%d]: %w", kind.name, i, err)
+			}
+
+			if change == nil {
+				report.Unchanged[kind.name]++
+				continue
+			}
+
+			report.Changes = append(report.Changes, *change)
+		}
+	}
+
+	if dryRun {
+		return report, nil
+	}
+
+	return report, tx.Commit()
+}
+
+// ErrImportParentNotFound is returned when a row references a parent pk_id that is
+// neither in the database nor earlier in the batch.
+var ErrImportParentNotFound = errors.New("parent not found")
+
+// ErrImportGenerationMismatch is returned when a version's generation belongs to a
+// different model than the version itself.
+var ErrImportGenerationMismatch = errors.New("generation does not belong to the version's model")
+
+// checkImportVersionGeneration applies the check the admin API makes on versions:
+// the generation must belong to the version's model. Either one may come from the
+// row already stored when the import only changes the other.
+func checkImportVersionGeneration(ctx context.Context, tx *sql.Tx, pkID string, values map[string]string) error {
+	modelID, hasModel := values["model_id"]
+	genID, hasGen := values["gen_id"]
+	if !hasModel && !hasGen {
+		return nil
+	}
+
+	if !hasModel || !hasGen {
+		var storedModel, storedGen sql.NullString
+
+		err := tx.QueryRowContext(ctx, `SELECT model_id::TEXT, gen_id::TEXT FROM data_versions WHERE pk_id = $1`, pkID).Scan(&storedModel, &storedGen)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if !hasModel {
+			modelID = storedModel.String
+		}
+		if !hasGen {
+			genID = storedGen.String
+		}
+	}
+
+	if modelID == "" || genID == "" {
+		return nil
+	}
+
+	var genModel string
+
+	err := tx.QueryRowContext(ctx, `SELECT model_id::TEXT FROM data_generations WHERE id = $1`, genID).Scan(&genModel)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("gen_id %s: %w", genID, ErrImportParentNotFound)
+		}
+		return err
+	}
+
+	if genModel != modelID {
+		return fmt.Errorf("gen_id %s of model_id %s: %w", genID, genModel, ErrImportGenerationMismatch)
+	}
+
+	return nil
+}
+
+func importRow(ctx context.Context, tx *sql.Tx, kind importKind, row map[string]string) (*ImportChange, error) {
+	values := map[string]string{}
+
+	for _, column := range kind.columns {
+		if value, ok := row[column]; ok {
+			values[column] = value
+		}
+	}
+
+	for _, parent := range kind.parents {
+		pkID, ok := row[parent.field]
+		if !ok {
+			continue
+		}
+		if pkID == "" {
+			values[parent.column] = ""
+			continue
+		}
+
+		var id int64
+		err := tx.QueryRowContext(ctx, `SELECT id FROM `+parent.table+` WHERE pk_id = $1`, pkID).Scan(&id)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("%s %s: %w", parent.field, pkID, ErrImportParentNotFound)
+			}
+			return nil, err
+		}
+		values[parent.column] = strconv.FormatInt(id, 10)
+	}
+
+	if kind.name == "versions" {
+		err := checkImportVersionGeneration(ctx, tx, row["pk_id"], values)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	columns := make([]string, 0, len(values))
+	for column := range values {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	existing, err := selectImportRow(ctx, tx, kind.table, columns, row["pk_id"])
+	if err != nil {
+		return nil, err
+	}
+
+	change := &ImportChange{
+		Kind:   kind.name,
+		Action: "insert",
+		PkID:   row["pk_id"],
+		Fields: map[string][2]string{},
+	}
+
+	if existing != nil {
+		change.Action = "update"
+	}
+
+	for _, column := range columns {
+		old := ""
+		if existing != nil {
+			old = existing[column]
+		}
+		if existing == nil || !sameImportValue(old, values[column]) {
+			change.Fields[column] = [2]string{old, values[column]}
+		}
+	}
+
+	if existing != nil && len(change.Fields) == 0 {
+		return nil, nil
+	}
+
+	args := []any{row["pk_id"]}
+	placeholders := []string{"$1"}
+	assignments := []string{}
+
+	for i, column := range columns {
+		args = append(args, sql.NullString{String: values[column], Valid: values[column] != ""})
+		placeholders = append(placeholders, fmt.Sprintf("$%d", i+2))
+		assignments = append(assignments, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (pk_id, %s) VALUES (%s)`,
+		kind.table, strings.Join(columns, ", "), strings.Join(placeholders, ", "))
+	if len(columns) == 0 {
+		query = fmt.Sprintf(`INSERT INTO %s (pk_id) VALUES ($1)`, kind.table)
+	}
+	if len(assignments) > 0 {
+		query += ` ON CONFLICT (pk_id) DO UPDATE SET ` + strings.Join(assignments, ", ")
+	} else {
+		query += ` ON CONFLICT (pk_id) DO NOTHING`
+	}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+// selectImportRow returns the current values of columns as text for the row with
+// pkID, or nil if there is no such row.
+func selectImportRow(ctx context.Context, tx *sql.Tx, table string, columns []string, pkID string) (map[string]string, error) {
+	selects := []string{"1"}
+	for _, column := range columns {
+		selects = append(selects, fmt.Sprintf("COALESCE(TRIM(%s::TEXT), '')", column))
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM %s WHERE pk_id = $1`, strings.Join(selects, ", "), table)
+
+	dest := make([]any, len(columns)+1)
+	var one int
+	dest[0] = &one
+	values := make([]string, len(columns))
+	for i := range values {
+		dest[i+1] = &values[i]
+	}
+
+	err := tx.QueryRowContext(ctx, query, pkID).Scan(dest...)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	existing := map[string]string{}
+	for i, column := range columns {
+		existing[column] = values[i]
+	}
+
+	return existing, nil
+}
+
+// sameImportValue compares a stored value with an imported one, treating the
+// spellings Postgres accepts for booleans as equal.
+func sameImportValue(stored, imported string) bool {
+	imported = strings.TrimSpace(imported)
+	if stored == imported {
+		return true
+	}
+
+	storedBool, err := strconv.ParseBool(stored)
+	if err != nil {
+		return false
+	}
+	importedBool, err := strconv.ParseBool(imported)
+	if err != nil {
+		return false
+	}
+
+	return storedBool == importedBool
+}
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	"ghostprotocols.pk/internal/validator"
 )
 
 type ListingsModel struct {
@@ -31,9 +33,11 @@ type Listing struct {
 	ID        int       `json:"id,omitempty"`
 	UpdatedAt time.Time `json:"updated_at,omitempty"`
 	CreatedAt time.Time `json:"-"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
 
-	Active   bool `json:"active"`
-	Featured bool `json:"featured"`
+	Status   string `json:"status"`
+	Active   bool   `json:"active"`
+	Featured bool   `json:"featured"`
 
 	GpManaged   bool `json:"gp_managed"`
 	GpCertified bool `json:"gp_certified"`
@@ -76,9 +80,127 @@ type Listing struct {
 	UpVersion int32 `json:"-"`
 }
 
+const (
+	ListingStatusDraft   = "draft"
+	ListingStatusActive  = "active"
+	ListingStatusSold    = "sold"
+	ListingStatusExpired = "expired"
+	ListingStatusRemoved = "removed"
+)
+
+// listingTransitions lists the statuses a seller may move a listing to from its
+// current status.
+var listingTransitions = map[string][]string{
+	ListingStatusDraft:   {ListingStatusActive, ListingStatusRemoved},
+	ListingStatusActive:  {ListingStatusDraft, ListingStatusSold, ListingStatusRemoved},
+	ListingStatusSold:    {ListingStatusActive, ListingStatusRemoved},
+	ListingStatusExpired: {ListingStatusRemoved},
+	ListingStatusRemoved: {},
+}
+
+func (l *Listing) CanTransitionTo(status string) bool {
+	return validator.PermittedValue(status, listingTransitions[l.Status]...)
+}
+
+// ListingCatalog holds what the catalog says about the make, model, version and
+// area a listing refers to. Each field is only valid if the referenced row exists.
+type ListingCatalog struct {
+	ModelMakeID    sql.NullInt32
+	VersionModelID sql.NullInt32
+	StartYear      sql.NullInt32
+	EndYear        sql.NullInt32
+	Transmission   sql.NullInt16
+	FuelType       sql.NullInt16
+	EngineCapacity sql.NullInt32
+	AreaCityID     sql.NullInt32
+
+	// The Known fields say whether the listing's registration city, city, color
+	// and body type, and the transmission and fuel type it ends up with once
+	// ApplyDefaults has run, exist.
+	RegistrationKnown bool
+	CityKnown         bool
+	ColorKnown        bool
+	BodyTypeKnown     bool
+	TransmissionKnown bool
+	FuelTypeKnown     bool
+}
+
+// ApplyDefaults fills the transmission, fuel type and engine capacity the seller
+// left out from the version's details.
+func (c *ListingCatalog) ApplyDefaults(listing *Listing) {
+	if listing.TransmissionID == 0 && c.Transmission.Valid {
+		listing.TransmissionID = c.Transmission.Int16
+	}
+	if listing.FuelTypeID == 0 && c.FuelType.Valid {
+		listing.FuelTypeID = c.FuelType.Int16
+	}
+	if listing.EngineCapacity == 0 && c.EngineCapacity.Valid {
+		listing.EngineCapacity = c.EngineCapacity.Int32
+	}
+}
+
+func ValidateListingCatalog(v *validator.Validator, listing *Listing, c *ListingCatalog) {
+	v.Check(c.ModelMakeID.Valid, "model", "must be a known model")
+	v.Check(!c.ModelMakeID.Valid || c.ModelMakeID.Int32 == listing.MakeID, "model", "must belong to the selected make")
+
+	if listing.VersionID != 0 {
+		v.Check(c.VersionModelID.Valid, "version", "must be a known version")
+		v.Check(!c.VersionModelID.Valid || c.VersionModelID.Int32 == listing.ModelID, "version", "must belong to the selected model")
+
+		// A generation without an end year is still in production.
+		if c.StartYear.Valid {
+			v.Check(listing.Year >= c.StartYear.Int32, "year",
+				fmt.Sprintf("must not be before %d for the selected version", c.StartYear.Int32))
+		}
+		if c.EndYear.Valid {
+			v.Check(listing.Year <= c.EndYear.Int32, "year",
+				fmt.Sprintf("must not be after %d for the selected version", c.EndYear.Int32))
+		}
+	}
+
+	v.Check(listing.RegistrationID == 0 || c.RegistrationKnown, "registration", "must be a known registration city")
+	v.Check(listing.CityID == 0 || c.CityKnown, "city", "must be a known city")
+	v.Check(listing.ColorID == 0 || c.ColorKnown, "color", "must be a known color")
+	v.Check(listing.BodyTypeID == 0 || c.BodyTypeKnown, "body_type", "must be a known body type")
+	v.Check(listing.TransmissionID == 0 || c.TransmissionKnown, "transmission", "must be a known transmission")
+	v.Check(listing.FuelTypeID == 0 || c.FuelTypeKnown, "fueltype", "must be a known fuel type")
+
+	if listing.AreaID != 0 {
+		v.Check(c.AreaCityID.Valid, "area", "must be a known area")
+		v.Check(!c.AreaCityID.Valid || c.AreaCityID.Int32 == listing.CityID, "area", "must belong to the selected city")
+	}
+}
+
 type Image struct {
-	Url   string `json:"url"`
-	Order int16  `json:"order"`
+	Url      string `json:"url"`
+	ThumbUrl string `json:"thumb_url,omitempty"`
+	CardUrl  string `json:"card_url,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	Order    int16  `json:"order"`
+}
+
+func ValidateListing(v *validator.Validator, listing *Listing) {
+	v.Check(len(listing.Gallery) > 0, "gallery", "must contain at least one image")
+	v.Check(len(listing.Gallery) <= 20, "gallery", "must not contain more than 20 images")
+	for _, image := range listing.Gallery {
+		v.Check(image.Url != "", "gallery", "must not contain an empty url")
+	}
+
+	v.Check(listing.MakeID != 0, "make", "must be provided")
+	v.Check(listing.ModelID != 0, "model", "must be provided")
+	v.Check(listing.Year > 1940, "year", "must be greater than 1940")
+	v.Check(listing.Year <= int32(time.Now().Year()), "year", "must not be in the future")
+	v.Check(listing.Price > 0, "price", "must be greater than zero")
+	v.Check(listing.RegistrationID != 0, "registration", "must be provided")
+	v.Check(listing.CityID != 0, "city", "must be provided")
+	v.Check(len(listing.Mileage) <= 8, "mileage", "must not be more than 8 bytes long")
+	v.Check(listing.TransmissionID != 0, "transmission", "must be provided")
+	v.Check(listing.FuelTypeID != 0, "fueltype", "must be provided")
+	v.Check(listing.EngineCapacity >= 0, "engine_capacity", "must not be negative")
+	v.Check(listing.BodyTypeID != 0, "body_type", "must be provided")
+	v.Check(listing.ColorID != 0, "color", "must be provided")
+	v.Check(len(listing.Details) <= 5000, "details", "must not be more than 5000 bytes long")
 }
 
 func (m *ListingsModel) Insert(listing *Listing) error {
@@ -93,7 +215,7 @@ func (m *ListingsModel) Insert(listing *Listing) error {
     registration, city, area, mileage, transmission, fuel_type, engine_capacity, body_type,
     color, details, seller)
 	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17)
-	RETURNING id, updated_at, created_at;`
+	RETURNING id, status, updated_at, created_at, expires_at;`
 
 	args := []any{
 		galleryJSON,
@@ -118,7 +240,7 @@ func (m *ListingsModel) Insert(listing *Listing) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&listing.ID, &listing.UpdatedAt, &listing.CreatedAt)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&listing.ID, &listing.Status, &listing.UpdatedAt, &listing.CreatedAt, &listing.ExpiresAt)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: User does not have enough listing limit.`:
@@ -138,8 +260,8 @@ func (m *ListingsModel) GetById(id int64) (*Listing, error) {
 
 	query := `
         SELECT 
-    l.id, l.created_at, l.updated_at,
-    l.active, l.featured, 
+    l.id, l.created_at, l.updated_at, l.expires_at,
+    l.status, l.active, l.featured, 
     l.gp_managed, l.gp_certified, l.gp_yard,
     l.gallery, 
     m.name AS make_name,
@@ -197,7 +319,9 @@ WHERE l.id = $1;`
 		&listing.ID,
 		&listing.CreatedAt,
 		&listing.UpdatedAt,
+		&listing.ExpiresAt,
 
+		&listing.Status,
 		&listing.Active,
 		&listing.Featured,
 
@@ -279,8 +403,8 @@ func (m *ListingsModel) GetForUpdate(id int64) (*Listing, error) {
 
 	query := `
 	SELECT 
-		id, created_at, updated_at,
-		active,  featured,
+		id, created_at, updated_at, expires_at,
+		status, active, featured,
 		gp_managed, gp_certified, gp_yard,
 		gallery,
 		make, model, version, year, price,
@@ -311,7 +435,9 @@ func (m *ListingsModel) GetForUpdate(id int64) (*Listing, error) {
 		&listing.ID,
 		&listing.CreatedAt,
 		&listing.UpdatedAt,
+		&listing.ExpiresAt,
 
+		&listing.Status,
 		&listing.Active,
 		&listing.Featured,
 
@@ -340,7 +466,7 @@ func (m *ListingsModel) GetForUpdate(id int64) (*Listing, error) {
 		&listing.ColorID,
 		&listing.Details,
 
-		&listing.Seller.ID,
+		&listing.SellerID,
 		&listing.UpVersion,
 	)
 	if err != nil {
@@ -374,14 +500,17 @@ func (m *ListingsModel) GetForUpdate(id int64) (*Listing, error) {
 
 	// Assign unmarshaled gallery to the listing
 	listing.Gallery = gallery
-
-	// Print the listing for debugging
-	// fmt.Printf("Listing: %+v\n", listing)
+	listing.Seller.ID = int64(listing.SellerID)
 
 	return &listing, nil
 }
 
 func (m ListingsModel) Update(listing *Listing) error {
+	galleryJSON, err := json.Marshal(listing.Gallery)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	UPDATE listings 
 	SET active = $1, featured = $2,
@@ -398,7 +527,7 @@ func (m ListingsModel) Update(listing *Listing) error {
 	args := []any{
 		listing.Active, listing.Featured,
 		listing.GpManaged, listing.GpCertified, listing.GpYard,
-		listing.Gallery,
+		galleryJSON,
 		listing.MakeID, listing.ModelID,
 		sql.NullInt32{Int32: listing.VersionID, Valid: listing.VersionID != 0},
 		listing.Year, listing.Price,
@@ -411,18 +540,240 @@ func (m ListingsModel) Update(listing *Listing) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&listing.UpVersion)
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&listing.UpVersion)
 	if err != nil {
 		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: User does not have enough featured limit.`:
+			return ErrFeaturedLimitReached
 		default:
 			return err
-
 		}
 	}
 
 	return nil
 }
 
+// UpdateStatus moves a listing to listing.Status. Listings removed within the
+// refund grace window of being created give their listing slot back to the seller.
+func (m ListingsModel) UpdateStatus(listing *Listing, refundGrace time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `SELECT set_config('ghost.refund_grace', $1, true)`,
+		fmt.Sprintf("%d seconds", int64(refundGrace.Seconds())))
+	if err != nil {
+		return err
+	}
+
+	query := `
+	UPDATE listings
+	SET status = $1, active = ($1 = 'active'), upversion = upversion + 1
+	WHERE id = $2 AND upversion = $3
+	RETURNING active, upversion;
+	`
+
+	args := []any{listing.Status, listing.ID, listing.UpVersion}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&listing.Active, &listing.UpVersion)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Renew spends one of the seller's listing slots to put the listing back up for
+// the full duration of the seller's plan.
+func (m ListingsModel) Renew(listing *Listing) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE users
+	SET listing_limit = listing_limit - 1
+	WHERE id = $1 AND listing_limit > 0;
+	`
+
+	result, err := tx.ExecContext(ctx, query, listing.SellerID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrListingLimitReached
+	}
+
+	query = `
+	UPDATE listings
+	SET status = 'active', active = true,
+	expires_at = NOW() + listing_duration(seller), upversion = upversion + 1
+	WHERE id = $1 AND upversion = $2
+	RETURNING status, active, updated_at, expires_at, upversion;
+	`
+
+	err = tx.QueryRowContext(ctx, query, listing.ID, listing.UpVersion).Scan(
+		&listing.Status,
+		&listing.Active,
+		&listing.UpdatedAt,
+		&listing.ExpiresAt,
+		&listing.UpVersion,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+type ExpiredListing struct {
+	ID          int64
+	SellerID    int64
+	SellerName  string
+	SellerEmail string
+	SellerPhone string
+	Title       string
+}
+
+// ExpireDue marks every active listing whose expiry has passed as expired and
+// returns them so that their sellers can be notified.
+func (m ListingsModel) ExpireDue() ([]*ExpiredListing, error) {
+	query := `
+	WITH expired AS (
+		UPDATE listings
+		SET status = 'expired', active = false, upversion = upversion + 1
+		WHERE status = 'active' AND expires_at <= NOW()
+		RETURNING id, seller, make, model, year
+	)
+	SELECT e.id, u.id, COALESCE(u.name, ''), COALESCE(u.email, ''), COALESCE(u.phone, ''),
+	CONCAT_WS(' ', m.name, mo.name, e.year)
+	FROM expired e
+	JOIN users u ON e.seller = u.id
+	LEFT JOIN data_makes m ON e.make = m.id
+	LEFT JOIN data_models mo ON e.model = mo.id;
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expired := []*ExpiredListing{}
+
+	for rows.Next() {
+		var listing ExpiredListing
+		err := rows.Scan(
+			&listing.ID,
+			&listing.SellerID,
+			&listing.SellerName,
+			&listing.SellerEmail,
+			&listing.SellerPhone,
+			&listing.Title,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		expired = append(expired, &listing)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return expired, nil
+}
+
+func (m ListingsModel) GetCatalog(listing *Listing) (*ListingCatalog, error) {
+	query := `
+	SELECT
+		(SELECT make_id FROM data_models WHERE id = $1),
+		v.model_id, g.start_year, NULLIF(TRIM(g.end_year), '')::INT,
+		d.transmission_type, d.fuel_type, d.engine_capacity,
+		(SELECT city FROM areas WHERE id = $3),
+		EXISTS (SELECT 1 FROM registrations WHERE id = $4),
+		EXISTS (SELECT 1 FROM cities WHERE id = $5),
+		EXISTS (SELECT 1 FROM data_colors WHERE id = $6),
+		EXISTS (SELECT 1 FROM data_body_types WHERE id = $7),
+		EXISTS (SELECT 1 FROM data_transmissions WHERE id = COALESCE(NULLIF($8, 0), d.transmission_type)),
+		EXISTS (SELECT 1 FROM fuel_types WHERE id = COALESCE(NULLIF($9, 0), d.fuel_type))
+	FROM (SELECT 1) AS one
+	LEFT JOIN data_versions v ON v.id = $2
+	LEFT JOIN data_generations g ON g.id = v.gen_id
+	LEFT JOIN data_details d ON d.version_id = v.id
+	LIMIT 1;
+	`
+
+	var c ListingCatalog
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{
+		listing.ModelID,
+		listing.VersionID,
+		listing.AreaID,
+		listing.RegistrationID,
+		listing.CityID,
+		listing.ColorID,
+		listing.BodyTypeID,
+		listing.TransmissionID,
+		listing.FuelTypeID,
+	}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&c.ModelMakeID,
+		&c.VersionModelID,
+		&c.StartYear,
+		&c.EndYear,
+		&c.Transmission,
+		&c.FuelType,
+		&c.EngineCapacity,
+		&c.AreaCityID,
+		&c.RegistrationKnown,
+		&c.CityKnown,
+		&c.ColorKnown,
+		&c.BodyTypeKnown,
+		&c.TransmissionKnown,
+		&c.FuelTypeKnown,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
 type ListingFilter struct {
 	Make             int32        `json:"make,omitempty"`
 	Model            int32        `json:"model,omitempty"`
@@ -435,6 +786,7 @@ type ListingFilter struct {
 	Active           *bool        `json:"active,omitempty"`
 	Featured         *bool        `json:"featured,omitempty"`
 	GpManaged        *bool        `json:"gp_managed,omitempty"`
+	Status           string       `json:"status,omitempty"`
 }
 
 type NumberFilter struct {
@@ -446,7 +798,7 @@ func (m *ListingsModel) GetAll(f ListingFilter, s Sorting) ([]*Listing, Metadata
 	query := fmt.Sprintf(`
 	SELECT 
 			l.id, l.updated_at,
-			l.active, l.featured, 
+			l.status, l.active, l.featured, 
 			l.gp_managed,l.gp_certified, l.gp_yard,
 			l.gallery, 
 			m.name AS make,
@@ -480,9 +832,10 @@ func (m *ListingsModel) GetAll(f ListingFilter, s Sorting) ([]*Listing, Metadata
 			AND ($10::BOOL IS NULL OR l.active = $10)
 			AND ($11::BOOL IS NULL OR l.featured = $11)
 			AND ($12::BOOL IS NULL OR l.gp_managed = $12)
+			AND ($13::TEXT IS NULL OR l.status = $13)
 		
 		ORDER BY %s %s, l.id DESC
-		LIMIT $13 OFFSET $14;
+		LIMIT $14 OFFSET $15;
 
 	`, s.sortColumn(), s.sortDirection())
 
@@ -502,6 +855,7 @@ func (m *ListingsModel) GetAll(f ListingFilter, s Sorting) ([]*Listing, Metadata
 		sql.NullBool{Bool: f.Active != nil && *f.Active, Valid: f.Active != nil},
 		sql.NullBool{Bool: f.Featured != nil && *f.Featured, Valid: f.Featured != nil},
 		sql.NullBool{Bool: f.GpManaged != nil && *f.GpManaged, Valid: f.GpManaged != nil},
+		sql.NullString{String: f.Status, Valid: f.Status != ""},
 		s.limit(),
 		s.offset(),
 	}
@@ -526,6 +880,7 @@ func (m *ListingsModel) GetAll(f ListingFilter, s Sorting) ([]*Listing, Metadata
 		err := rows.Scan(
 			&listing.ID,
 			&listing.UpdatedAt,
+			&listing.Status,
 			&listing.Active,
 			&listing.Featured,
 			&listing.GpManaged,
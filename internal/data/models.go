@@ -6,24 +6,35 @@ import (
 )
 
 type Models struct {
-	Users    UserModel
-	Tokens   TokenModel
-	Listings ListingsModel
-	Data     DataModel
+	Users           UserModel
+	Tokens          TokenModel
+	Listings        ListingsModel
+	Data            DataModel
+	Permissions     PermissionModel
+	MediaUploads    MediaUploadModel
+	DuplicatePhotos DuplicatePhotoModel
+	PhoneOTPs       PhoneOTPModel
+	LoginAttempts   LoginAttemptModel
 }
 
 func NewModels(db *sql.DB) Models {
 	return Models{
-		Users:    UserModel{DB: db},
-		Tokens:   TokenModel{DB: db},
-		Listings: ListingsModel{DB: db},
-		Data:     DataModel{DB: db},
+		Users:           UserModel{DB: db},
+		Tokens:          TokenModel{DB: db},
+		Listings:        ListingsModel{DB: db},
+		Data:            DataModel{DB: db},
+		Permissions:     PermissionModel{DB: db},
+		MediaUploads:    MediaUploadModel{DB: db},
+		DuplicatePhotos: DuplicatePhotoModel{DB: db},
+		PhoneOTPs:       PhoneOTPModel{DB: db},
+		LoginAttempts:   LoginAttemptModel{DB: db},
 	}
 }
 
 // Errors
 var (
-	ErrRecordNotFound      = errors.New("No Record Found")
-	ErrEditConflict        = errors.New("Conflict in Edit")
-	ErrListingLimitReached = errors.New("You have reached your Listings Limit")
+	ErrRecordNotFound       = errors.New("No Record Found")
+	ErrEditConflict         = errors.New("Conflict in Edit")
+	ErrListingLimitReached  = errors.New("You have reached your Listings Limit")
+	ErrFeaturedLimitReached = errors.New("You have reached your Featured Limit")
 )
@@ -0,0 +1,230 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"ghostprotocols.pk/internal/validator"
+)
+
+var (
+	ErrOTPRateLimited      = errors.New("too many codes requested")
+	ErrOTPInvalid          = errors.New("invalid or expired code")
+	ErrOTPAttemptsExceeded = errors.New("too many incorrect attempts")
+)
+
+// OTPRateLimitedError is returned, wrapping ErrOTPRateLimited, when a code may not
+// be sent yet. RetryAfter is how long until the next one can be.
+type OTPRateLimitedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *OTPRateLimitedError) Error() string {
+	return ErrOTPRateLimited.Error()
+}
+
+func (e *OTPRateLimitedError) Unwrap() error {
+	return ErrOTPRateLimited
+}
+
+// OTPLimits bounds how often codes may be sent to and tried by a user.
+type OTPLimits struct {
+	TTL         time.Duration
+	Cooldown    time.Duration
+	MaxSends    int
+	SendWindow  time.Duration
+	MaxAttempts int
+}
+
+type PhoneOTP struct {
+	Plaintext string
+	UserID    int64
+	Phone     string
+	Expiry    time.Time
+}
+
+type PhoneOTPModel struct {
+	DB *sql.DB
+}
+
+func ValidateOTPPlaintext(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+}
+
+// hashOTP binds the code to the phone it was sent to, so a code cannot be used to
+// verify a number the user switched to afterwards.
+func hashOTP(phone, code string) []byte {
+	hash := sha256.Sum256([]byte(phone + ":" + code))
+	return hash[:]
+}
+
+func generateOTP() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// New replaces the user's outstanding code with a new one for phone. It returns an
+// *OTPRateLimitedError when the previous code was sent less than limits.Cooldown
+// ago or limits.MaxSends codes were already sent in the current window.
+func (m PhoneOTPModel) New(userID int64, phone string, limits OTPLimits) (*PhoneOTP, error) {
+	code, err := generateOTP()
+	if err != nil {
+		return nil, err
+	}
+
+	otp := &PhoneOTP{
+		Plaintext: code,
+		UserID:    userID,
+		Phone:     phone,
+		Expiry:    time.Now().Add(limits.TTL),
+	}
+
+	query := `
+	INSERT INTO phone_otps (user_id, phone, code_hash, expiry)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (user_id) DO UPDATE
+	SET phone = EXCLUDED.phone, code_hash = EXCLUDED.code_hash, expiry = EXCLUDED.expiry,
+	attempts = 0, sent_at = NOW(),
+	sends = CASE WHEN phone_otps.window_start < NOW() - make_interval(secs => $6) THEN 1 ELSE phone_otps.sends + 1 END,
+	window_start = CASE WHEN phone_otps.window_start < NOW() - make_interval(secs => $6) THEN NOW() ELSE phone_otps.window_start END
+	WHERE phone_otps.sent_at < NOW() - make_interval(secs => $5)
+	AND (phone_otps.window_start < NOW() - make_interval(secs => $6) OR phone_otps.sends < $7)
+	RETURNING user_id`
+
+	args := []any{
+		userID,
+		phone,
+		hashOTP(phone, code),
+		otp.Expiry,
+		limits.Cooldown.Seconds(),
+		limits.SendWindow.Seconds(),
+		limits.MaxSends,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&otp.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, m.rateLimited(ctx, userID, limits)
+		default:
+			return nil, err
+		}
+	}
+
+	return otp, nil
+}
+
+// rateLimited works out when the user may next be sent a code: once the cooldown
+// has passed and, if the window's sends are used up, once the window has ended.
+func (m PhoneOTPModel) rateLimited(ctx context.Context, userID int64, limits OTPLimits) error {
+	query := `
+	SELECT GREATEST(
+		EXTRACT(EPOCH FROM sent_at + make_interval(secs => $2) - NOW()),
+		CASE WHEN window_start >= NOW() - make_interval(secs => $3) AND sends >= $4
+		THEN EXTRACT(EPOCH FROM window_start + make_interval(secs => $3) - NOW())
+		ELSE 0 END,
+		0)::FLOAT8
+	FROM phone_otps
+	WHERE user_id = $1`
+
+	var seconds float64
+
+	err := m.DB.QueryRowContext(ctx, query, userID, limits.Cooldown.Seconds(), limits.SendWindow.Seconds(), limits.MaxSends).Scan(&seconds)
+	if err != nil {
+		return err
+	}
+
+	return &OTPRateLimitedError{RetryAfter: time.Duration(seconds * float64(time.Second))}
+}
+
+// Verify checks code against the user's outstanding code for phone. On a match
+// the code is used up and the user's phone is marked verified. Every miss counts
+// against limits.MaxAttempts, after which the code can no longer be used.
+func (m PhoneOTPModel) Verify(userID int64, phone, code string, limits OTPLimits) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var (
+		storedPhone string
+		codeHash    []byte
+		expiry      time.Time
+		attempts    int
+	)
+
+	err = tx.QueryRowContext(ctx, `
+	SELECT phone, code_hash, expiry, attempts
+	FROM phone_otps
+	WHERE user_id = $1
+	FOR UPDATE`, userID).Scan(&storedPhone, &codeHash, &expiry, &attempts)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrOTPInvalid
+		default:
+			return err
+		}
+	}
+
+	if attempts >= limits.MaxAttempts {
+		return ErrOTPAttemptsExceeded
+	}
+
+	match := subtle.ConstantTimeCompare(codeHash, hashOTP(phone, code)) == 1
+	if !match || storedPhone != phone || time.Now().After(expiry) {
+		_, err = tx.ExecContext(ctx, `UPDATE phone_otps SET attempts = attempts + 1 WHERE user_id = $1`, userID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+
+		return ErrOTPInvalid
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM phone_otps WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `
+	UPDATE users
+	SET phone_verified = true, version = version + 1
+	WHERE id = $1 AND phone = $2`, userID, phone)
+	if err != nil {
+		return err
+	}
+
+	// The user changed their number since the code was sent.
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrOTPInvalid
+	}
+
+	return tx.Commit()
+}
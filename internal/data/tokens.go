@@ -6,6 +6,9 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"ghostprotocols.pk/internal/validator"
@@ -14,16 +17,54 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
 )
 
+// TokenReusedError is returned when a refresh token that was already rotated is
+// presented again. The token family it belonged to has been revoked.
+type TokenReusedError struct {
+	UserID   int64
+	FamilyID int64
+}
+
+func (e *TokenReusedError) Error() string {
+	return fmt.Sprintf("refresh token of family %d reused", e.FamilyID)
+}
+
+// SessionTTL is how long the tokens of a session last.
+type SessionTTL struct {
+	Access  time.Duration
+	Refresh time.Duration
+}
+
 type Token struct {
+	ID        int64     `json:"-"`
+	FamilyID  int64     `json:"-"`
 	Plaintext string    `json:"token"`
 	Hash      []byte    `json:"-"`
 	UserID    int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+	IP        string    `json:"-"`
+	UserAgent string    `json:"-"`
+}
+
+// Session describes a token family to the user it belongs to, without the tokens
+// themselves.
+type Session struct {
+	ID        int64      `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  *time.Time `json:"last_used"`
+	IP        string     `json:"ip"`
+	UserAgent string     `json:"user_agent"`
+	Expiry    time.Time  `json:"expiry"`
+	Current   bool       `json:"current"`
 }
 
+// maxUserAgentLength caps how much of a client supplied User-Agent is stored.
+const maxUserAgentLength = 512
+
 type TokenModel struct {
 	DB *sql.DB
 }
@@ -64,18 +105,295 @@ func (m TokenModel) New(userID int64, ttl time.Duration, scope string) (*Token,
 	return token, err
 }
 
+// NewSession starts a session for a user signing in from ip with the given user
+// agent. It returns a short-lived access token and the refresh token that can be
+// exchanged for the next pair, both in a new token family.
+func (m TokenModel) NewSession(userID int64, ip, userAgent string, ttl SessionTTL) (*Token, *Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var familyID int64
+
+	err = tx.QueryRowContext(ctx, `SELECT nextval('token_families_seq')`).Scan(&familyID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertTokenPair(ctx, tx, userID, familyID, ip, userAgent, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+// Rotate exchanges a refresh token for a new access and refresh token in the same
+// family. A refresh token can only be used once: presenting one that was already
+// rotated means it was copied, so the whole family is revoked and a
+// *TokenReusedError returned. The family's earlier access tokens stop working too.
+func (m TokenModel) Rotate(refreshPlaintext, ip, userAgent string, ttl SessionTTL) (*Token, *Token, error) {
+	refreshHash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	var (
+		userID   int64
+		familyID int64
+		expiry   time.Time
+		rotated  bool
+	)
+
+	err = tx.QueryRowContext(ctx, `
+	SELECT user_id, family_id, expiry, rotated
+	FROM tokens
+	WHERE hash = $1 AND scope = $2
+	FOR UPDATE`, refreshHash[:], ScopeRefresh).Scan(&userID, &familyID, &expiry, &rotated)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	if rotated {
+		_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE family_id = $1`, familyID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = tx.Commit()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, &TokenReusedError{UserID: userID, FamilyID: familyID}
+	}
+
+	if time.Now().After(expiry) {
+		return nil, nil, ErrRecordNotFound
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE tokens
+	SET rotated = true, last_used = NOW(), ip = $2, user_agent = $3
+	WHERE hash = $1`, refreshHash[:], ip, truncate(userAgent, maxUserAgentLength))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM tokens
+	WHERE family_id = $1 AND scope = $2`, familyID, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	access, refresh, err := insertTokenPair(ctx, tx, userID, familyID, ip, userAgent, ttl)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return access, refresh, tx.Commit()
+}
+
+func insertTokenPair(ctx context.Context, tx *sql.Tx, userID, familyID int64, ip, userAgent string, ttl SessionTTL) (*Token, *Token, error) {
+	access, err := generateToken(userID, ttl.Access, ScopeAuthentication)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refresh, err := generateToken(userID, ttl.Refresh, ScopeRefresh)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, token := range []*Token{access, refresh} {
+		token.FamilyID = familyID
+		token.IP = ip
+		token.UserAgent = truncate(userAgent, maxUserAgentLength)
+
+		err = tx.QueryRowContext(ctx, insertTokenQuery, token.args()...).Scan(&token.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return access, refresh, nil
+}
+
+const insertTokenQuery = `
+	INSERT INTO tokens (hash, user_id, expiry, scope, ip, user_agent, family_id)
+	VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, 0))
+	RETURNING id`
+
+func (t *Token) args() []any {
+	return []any{t.Hash, t.UserID, t.Expiry, t.Scope, t.IP, t.UserAgent, t.FamilyID}
+}
+
 func (m TokenModel) Insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, insertTokenQuery, token.args()...).Scan(&token.ID)
+}
+
+// Touch records that an access token was just used from ip with the given user
+// agent, and returns the ID of its session.
+func (m TokenModel) Touch(tokenPlaintext, ip, userAgent string) (int64, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
 	query := `
-	INSERT INTO tokens (hash, user_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
+	UPDATE tokens
+	SET last_used = NOW(), ip = $2, user_agent = $3
+	WHERE hash = $1 AND scope = $4
+	RETURNING family_id`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{tokenHash[:], ip, truncate(userAgent, maxUserAgentLength), ScopeAuthentication}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	var id int64
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return id, nil
+}
+
+// GetSessions returns the user's sessions that still have a usable token, most
+// recently used first. A session is a token family: it starts when the user signs
+// in and lasts as long as its refresh token keeps being rotated. The session with
+// ID currentID is marked as the current one.
+func (m TokenModel) GetSessions(userID, currentID int64) ([]*Session, error) {
+	query := `
+	SELECT family_id, MIN(created_at), MAX(last_used),
+	(array_agg(ip ORDER BY COALESCE(last_used, created_at) DESC))[1],
+	(array_agg(user_agent ORDER BY COALESCE(last_used, created_at) DESC))[1],
+	MAX(expiry) FILTER (WHERE NOT rotated)
+	FROM tokens
+	WHERE user_id = $1 AND scope IN ($2, $3)
+	GROUP BY family_id
+	HAVING bool_or(NOT rotated AND expiry > NOW())
+	ORDER BY COALESCE(MAX(last_used), MIN(created_at)) DESC, family_id DESC`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var (
+			session  Session
+			lastUsed sql.NullTime
+		)
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&lastUsed,
+			&session.IP,
+			&session.UserAgent,
+			&session.Expiry,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if lastUsed.Valid {
+			session.LastUsed = &lastUsed.Time
+		}
+		session.Current = session.ID == currentID
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes every access and refresh token in one of the user's
+// sessions.
+func (m TokenModel) DeleteSession(userID, id int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE family_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// truncate cuts s to at most n bytes without leaving a partial rune behind.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return strings.ToValidUTF8(s[:n], "")
+	}
+	return s
+}
+
+// DeleteExpired deletes tokens of every scope that have expired, including
+// rotated refresh tokens, and returns how many it deleted.
+func (m TokenModel) DeleteExpired() (int64, error) {
+	query := `
+	DELETE FROM tokens
+	WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
 }
 
 func (m TokenModel) DeleteAllForUser(scope string, userID int64) error {
@@ -0,0 +1,276 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	UploadKindGallery = "gallery"
+	UploadKindProfile = "profile"
+)
+
+const (
+	UploadStatusPending  = "pending"
+	UploadStatusClaimed  = "claimed"
+	UploadStatusReplaced = "replaced"
+	UploadStatusDeleting = "deleting"
+)
+
+const (
+	ProcessingPending = "pending"
+	ProcessingReady   = "ready"
+	ProcessingFailed  = "failed"
+)
+
+// MediaUpload records a file stored in the media store. Uploads are claimed by
+// database triggers when a listing gallery or a user's profile picture references
+// them.
+type MediaUpload struct {
+	ID        string `json:"id"`
+	OwnerID   int64  `json:"owner_id"`
+	Kind      string `json:"kind"`
+	Status    string `json:"status"`
+	ListingID int64  `json:"listing_id,omitempty"`
+	// Processing tracks the background resizing of gallery uploads. Width and
+	// Height are those of the full rendition once it is ready.
+	Processing string    `json:"processing"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	DHash      uint64    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+type MediaUploadModel struct {
+	DB *sql.DB
+}
+
+func (m MediaUploadModel) Insert(upload *MediaUpload) error {
+	query := `
+	INSERT INTO media_uploads (id, owner_id, kind, processing)
+	VALUES ($1, $2, $3, $4)
+	RETURNING status, created_at, updated_at`
+
+	args := []any{upload.ID, upload.OwnerID, upload.Kind, upload.Processing}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(
+		&upload.Status,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+}
+
+func (m MediaUploadModel) Get(id string) (*MediaUpload, error) {
+	query := `
+	SELECT id, owner_id, kind, status, listing_id, processing, width, height, created_at, updated_at
+	FROM media_uploads
+	WHERE id::TEXT = $1`
+
+	var (
+		upload    MediaUpload
+		listingID sql.NullInt64
+		width     sql.NullInt32
+		height    sql.NullInt32
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&upload.ID,
+		&upload.OwnerID,
+		&upload.Kind,
+		&upload.Status,
+		&listingID,
+		&upload.Processing,
+		&width,
+		&height,
+		&upload.CreatedAt,
+		&upload.UpdatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	upload.ListingID = listingID.Int64
+	upload.Width = int(width.Int32)
+	upload.Height = int(height.Int32)
+
+	return &upload, nil
+}
+
+// GetGallery returns the gallery uploads of ownerID among ids that have not been
+// swept or claimed by another listing, keyed by id.
+func (m MediaUploadModel) GetGallery(ownerID int64, listingID int64, ids []string) (map[string]*MediaUpload, error) {
+	query := `
+	SELECT id, processing, width, height
+	FROM media_uploads
+	WHERE kind = 'gallery' AND owner_id = $1 AND id::TEXT = ANY($2)
+	AND (status = 'pending' OR (status = 'claimed' AND listing_id = $3))`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, ownerID, pq.Array(ids), listingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := map[string]*MediaUpload{}
+
+	for rows.Next() {
+		var (
+			upload = MediaUpload{OwnerID: ownerID, Kind: UploadKindGallery}
+			width  sql.NullInt32
+			height sql.NullInt32
+		)
+
+		err := rows.Scan(&upload.ID, &upload.Processing, &width, &height)
+		if err != nil {
+			return nil, err
+		}
+
+		upload.Width = int(width.Int32)
+		upload.Height = int(height.Int32)
+		uploads[upload.ID] = &upload
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// SetProcessed records the outcome of processing an upload and reads back the
+// listing that has claimed it in the meantime, if any.
+func (m MediaUploadModel) SetProcessed(upload *MediaUpload) error {
+	query := `
+	UPDATE media_uploads
+	SET processing = $1, width = $2, height = $3, dhash = $4
+	WHERE id = $5
+	RETURNING listing_id`
+
+	args := []any{
+		upload.Processing,
+		sql.NullInt32{Int32: int32(upload.Width), Valid: upload.Width != 0},
+		sql.NullInt32{Int32: int32(upload.Height), Valid: upload.Height != 0},
+		sql.NullInt64{Int64: int64(upload.DHash), Valid: upload.Processing == ProcessingReady},
+		upload.ID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var listingID sql.NullInt64
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&listingID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	upload.ListingID = listingID.Int64
+
+	return nil
+}
+
+// abandonedProcessing is how long an upload may stay in the pending processing
+// state before it is assumed that the worker processing it went away, e.g. because
+// the server was restarted, and nothing will finish it.
+const abandonedProcessing = 6 * time.Hour
+
+// MarkSweepable moves up to limit uploads that can be removed to the deleting
+// status and returns them: pending uploads nothing has claimed for longer than
+// olderThan, gallery uploads of listings removed longer than olderThan ago and
+// replaced profile pictures. Uploads an image worker may still be writing are left
+// alone. Uploads left deleting by an earlier sweep that failed are returned again.
+func (m MediaUploadModel) MarkSweepable(olderThan time.Duration, limit int) ([]*MediaUpload, error) {
+	query := `
+	UPDATE media_uploads
+	SET status = 'deleting', updated_at = NOW()
+	WHERE id IN (
+		SELECT u.id FROM media_uploads u
+		LEFT JOIN listings l ON l.id = u.listing_id
+		WHERE u.status = 'deleting'
+		OR (
+			(u.processing <> 'pending' OR u.created_at < NOW() - make_interval(secs => $3))
+			AND (
+				u.status = 'replaced'
+				OR (u.status = 'pending' AND u.updated_at < NOW() - make_interval(secs => $1))
+				OR (u.status = 'claimed' AND u.kind = 'gallery' AND (
+					u.listing_id IS NULL
+					OR (l.status = 'removed' AND l.updated_at < NOW() - make_interval(secs => $1))
+				))
+			)
+		)
+		ORDER BY u.updated_at
+		LIMIT $2
+		FOR UPDATE OF u SKIP LOCKED
+	)
+	RETURNING id, owner_id, kind, status, created_at, updated_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, olderThan.Seconds(), limit, abandonedProcessing.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	uploads := []*MediaUpload{}
+
+	for rows.Next() {
+		var upload MediaUpload
+
+		err := rows.Scan(
+			&upload.ID,
+			&upload.OwnerID,
+			&upload.Kind,
+			&upload.Status,
+			&upload.CreatedAt,
+			&upload.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		uploads = append(uploads, &upload)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return uploads, nil
+}
+
+// Delete removes the record of an upload the sweeper has deleted the files of.
+func (m MediaUploadModel) Delete(id string) error {
+	query := `
+	DELETE FROM media_uploads
+	WHERE id = $1 AND status = 'deleting'`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
@@ -21,7 +21,7 @@ type User struct {
 	Email         string    `json:"email"`
 	EmailVerfied  bool      `json:"email_verified"`
 	Phone         string    `json:"phone"`
-	PhoneVerified string    `json:"phone_verified"`
+	PhoneVerified bool      `json:"phone_verified"`
 	Password      password  `json:"-"`
 	ProfilePic    string    `json:"profile_pic"`
 	City          int64     `json:"city"`
@@ -30,6 +30,9 @@ type User struct {
 	FeaturedLimit int64     `json:"featured_limit"`
 	Version       int64     `json:"-"`
 	IsDealer      bool      `json:"is_dealer"`
+	// Grandfathered is set for accounts created before activation tokens were
+	// sent, which count as activated without having verified anything.
+	Grandfathered bool `json:"-"`
 }
 
 type Dealer struct {
@@ -80,6 +83,17 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// dummyPasswordHash is a bcrypt hash, at the cost Set uses, that no password
+// matches.
+var dummyPasswordHash = []byte("$2a$12$xghg0eQWMdjNrnsqcEbrwOOkUzYMamLEqexmiW78fNR4SCbInxory")
+
+// SimulatePasswordMatch takes as long as Matches does, for when there is no user to
+// check a password against. Returning straight away would tell the caller that no
+// account uses the identifier they tried.
+func SimulatePasswordMatch(plaintextPassword string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(plaintextPassword))
+}
+
 // VALIDATORS
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
@@ -191,7 +205,7 @@ func (m UserModel) GetUser(id int64) (*User, error) {
 	query := `
 	SELECT id, date_joined, name, email, email_verified, 
 	phone, phone_verified, password_hash, listing_limit, 
-	featured_limit, profile_pic, city,version
+	featured_limit, profile_pic, city,version, grandfathered_at IS NOT NULL
 	FROM users
 	WHERE id = $1`
 
@@ -214,6 +228,7 @@ func (m UserModel) GetUser(id int64) (*User, error) {
 		&user.ProfilePic,
 		&user.City,
 		&user.Version,
+		&user.Grandfathered,
 	)
 	if err != nil {
 		switch {
@@ -278,6 +293,56 @@ func (m UserModel) UpdateProfilePic(id int64, profile string) error {
 	return nil
 }
 
+// SetEmailVerified marks the user's email address as verified.
+func (m UserModel) SetEmailVerified(user *User) error {
+	query := `
+	UPDATE users
+	SET email_verified = true, version = version + 1
+	WHERE id = $1 AND version = $2
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	user.EmailVerfied = true
+
+	return nil
+}
+
+// UpdatePassword stores the user's new password hash.
+func (m UserModel) UpdatePassword(user *User) error {
+	query := `
+	UPDATE users
+	SET password_hash = $1, version = version + 1
+	WHERE id = $2 AND version = $3
+	RETURNING version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, user.Password.hash, user.ID, user.Version).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (m UserModel) UpdateUser(user *User) error {
 	query := `
 	UPDATE users
@@ -354,7 +419,7 @@ func (m UserModel) GetByPhone(phone string) (*User, error) {
 	query := `
 	SELECT id, date_joined, name, email, email_verified, 
 	phone, phone_verified, password_hash, listing_limit, 
-	featured_limit, version
+	featured_limit, version, grandfathered_at IS NOT NULL
 	FROM users
 	WHERE phone = $1`
 
@@ -375,6 +440,7 @@ func (m UserModel) GetByPhone(phone string) (*User, error) {
 		&user.ListingLimit,
 		&user.FeaturedLimit,
 		&user.Version,
+		&user.Grandfathered,
 	)
 	if err != nil {
 		switch {
@@ -391,7 +457,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 	query := `
 	SELECT id, date_joined, name, email, email_verified, 
 	phone, phone_verified, password_hash, listing_limit, 
-	featured_limit, version
+	featured_limit, version, grandfathered_at IS NOT NULL
 	FROM users
 	WHERE email = $1`
 
@@ -412,6 +478,7 @@ func (m UserModel) GetByEmail(email string) (*User, error) {
 		&user.ListingLimit,
 		&user.FeaturedLimit,
 		&user.Version,
+		&user.Grandfathered,
 	)
 	if err != nil {
 		switch {
@@ -431,7 +498,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 	query := `
 	SELECT id, date_joined, name, email, email_verified, 
 	phone, phone_verified, password_hash, listing_limit, 
-	featured_limit, version FROM users
+	featured_limit, version, grandfathered_at IS NOT NULL FROM users
 	INNER JOIN tokens
 	ON users.id = tokens.user_id
 	WHERE tokens.hash = $1
@@ -457,6 +524,7 @@ func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error)
 		&user.ListingLimit,
 		&user.FeaturedLimit,
 		&user.Version,
+		&user.Grandfathered,
 	)
 
 	if err != nil {
@@ -0,0 +1,89 @@
+// Package imaging decodes uploaded images safely: the format is detected from the
+// file contents, pixel dimensions are checked before any pixels are allocated and
+// JPEG EXIF orientation is applied.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"github.com/chai2010/webp"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("image must be a JPEG, PNG or WebP file")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+)
+
+type format struct {
+	decode       func(*bytes.Reader) (image.Image, error)
+	decodeConfig func(*bytes.Reader) (image.Config, error)
+}
+
+var formats = map[string]format{
+	"image/jpeg": {
+		decode:       func(r *bytes.Reader) (image.Image, error) { return jpeg.Decode(r) },
+		decodeConfig: func(r *bytes.Reader) (image.Config, error) { return jpeg.DecodeConfig(r) },
+	},
+	"image/png": {
+		decode:       func(r *bytes.Reader) (image.Image, error) { return png.Decode(r) },
+		decodeConfig: func(r *bytes.Reader) (image.Config, error) { return png.DecodeConfig(r) },
+	},
+	"image/webp": {
+		decode:       func(r *bytes.Reader) (image.Image, error) { return webp.Decode(r) },
+		decodeConfig: func(r *bytes.Reader) (image.Config, error) { return webp.DecodeConfig(r) },
+	},
+}
+
+// Check sniffs the format of b from its magic bytes and reads its dimensions
+// without decoding any pixels, rejecting formats other than JPEG, PNG and WebP and
+// images with more than maxPixels pixels.
+func Check(b []byte, maxPixels int) error {
+	_, err := check(b, maxPixels)
+	return err
+}
+
+func check(b []byte, maxPixels int) (string, error) {
+	contentType := http.DetectContentType(b)
+
+	f, ok := formats[contentType]
+	if !ok {
+		return "", ErrUnsupportedFormat
+	}
+
+	config, err := f.decodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return "", fmt.Errorf("unable to read image: %w", err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return "", ErrTooManyPixels
+	}
+
+	return contentType, nil
+}
+
+// Decode checks b as Check does and decodes it, rotating JPEGs upright. Only pixel
+// data is returned, so EXIF metadata such as GPS location is dropped and never
+// makes it into the re-encoded file.
+func Decode(b []byte, maxPixels int) (image.Image, error) {
+	contentType, err := check(b, maxPixels)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := formats[contentType].decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode image: %w", err)
+	}
+
+	if contentType == "image/jpeg" {
+		img = ApplyOrientation(img, Orientation(b))
+	}
+
+	return img, nil
+}
@@ -0,0 +1,33 @@
+package imaging
+
+import (
+	"image"
+
+	"github.com/nfnt/resize"
+)
+
+// DHash returns the 64-bit difference hash of img. The image is shrunk to 9x8
+// grayscale pixels and each bit records whether a pixel is brighter than its
+// right-hand neighbour, so resized or recompressed copies of a photo hash to
+// values a few bits apart.
+func DHash(img image.Image) uint64 {
+	small := resize.Resize(9, 8, img, resize.Bilinear)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if luma(small, x, y) > luma(small, x+1, y) {
+				hash |= 1
+			}
+		}
+	}
+
+	return hash
+}
+
+func luma(img image.Image, x, y int) uint32 {
+	b := img.Bounds()
+	r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+	return (299*r + 587*g + 114*bl) / 1000
+}
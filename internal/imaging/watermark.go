@@ -0,0 +1,95 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	"github.com/nfnt/resize"
+)
+
+// Watermark is composited over the bottom of an image: Logo in the right-hand
+// corner and Label, typically a listing ID, in the left-hand one.
+type Watermark struct {
+	Logo image.Image
+	// Label may only contain digits and '#', which is all the built-in font has.
+	Label string
+	// Opacity of the logo, between 0 and 1.
+	Opacity float64
+}
+
+// Apply returns a copy of img with the watermark drawn over it. The logo is
+// scaled to a fifth of the image width so that it stays legible at any size.
+func (wm *Watermark) Apply(img image.Image) image.Image {
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+
+	width, height := dst.Bounds().Dx(), dst.Bounds().Dy()
+	margin := max(width/40, 4)
+
+	if wm.Logo != nil {
+		logo := resize.Resize(uint(width/5), 0, wm.Logo, resize.Lanczos3)
+		lb := logo.Bounds()
+
+		at := image.Pt(width-margin-lb.Dx(), height-margin-lb.Dy())
+		mask := image.NewUniform(color.Alpha{A: uint8(wm.Opacity * 255)})
+
+		draw.DrawMask(dst, lb.Sub(lb.Min).Add(at), logo, lb.Min, mask, image.Point{}, draw.Over)
+	}
+
+	if wm.Label != "" {
+		scale := max(width/320, 1) * 2
+		y := height - margin - glyphHeight*scale
+
+		// A dark copy offset by one pixel keeps the label readable on light photos.
+		drawLabel(dst, wm.Label, margin+1, y+1, scale, color.NRGBA{A: 160})
+		drawLabel(dst, wm.Label, margin, y, scale, color.NRGBA{R: 255, G: 255, B: 255, A: 200})
+	}
+
+	return dst
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// glyphs is a 3x5 pixel font, one row per string with '1' marking a set pixel.
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"111", "101", "101", "101", "111"},
+	'1': {"010", "110", "010", "010", "111"},
+	'2': {"111", "001", "111", "100", "111"},
+	'3': {"111", "001", "111", "001", "111"},
+	'4': {"101", "101", "111", "001", "001"},
+	'5': {"111", "100", "111", "001", "111"},
+	'6': {"111", "100", "111", "101", "111"},
+	'7': {"111", "001", "001", "001", "001"},
+	'8': {"111", "101", "111", "101", "111"},
+	'9': {"111", "101", "111", "001", "111"},
+	'#': {"101", "111", "101", "111", "101"},
+}
+
+func drawLabel(dst *image.NRGBA, label string, x, y, scale int, c color.NRGBA) {
+	src := image.NewUniform(c)
+
+	for _, r := range label {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+
+		for row := 0; row < glyphHeight; row++ {
+			for col := 0; col < glyphWidth; col++ {
+				if glyph[row][col] != '1' {
+					continue
+				}
+
+				px := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(dst, px, src, image.Point{}, draw.Over)
+			}
+		}
+
+		x += (glyphWidth + 1) * scale
+	}
+}
@@ -0,0 +1,33 @@
+package mailer
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// LogMailer writes emails to out instead of sending them, for development and
+// tests.
+type LogMailer struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+func NewLog(out io.Writer) *LogMailer {
+	return &LogMailer{out: out}
+}
+
+func (m *LogMailer) Send(recipient, templateFile string, data any) error {
+	msg, err := render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err = fmt.Fprintf(m.out, "To: %s\nSubject: %s\n\n%s\n%s\n",
+		msg.To, msg.Subject, strings.TrimSpace(msg.PlainBody), strings.Repeat("-", 72))
+	return err
+}
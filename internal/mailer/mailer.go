@@ -0,0 +1,67 @@
+// Package mailer sends the transactional emails of the API from the templates
+// embedded in the templates directory.
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	texttemplate "text/template"
+)
+
+//go:embed "templates"
+var templateFS embed.FS
+
+// Mailer sends the email defined by templateFile, rendered with data, to
+// recipient.
+type Mailer interface {
+	Send(recipient, templateFile string, data any) error
+}
+
+// Message is a rendered email.
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// render executes the "subject", "plainBody" and "htmlBody" templates defined in
+// templateFile. The HTML body is rendered with html/template so that data is
+// escaped.
+func render(recipient, templateFile string, data any) (*Message, error) {
+	text, err := texttemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = text.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = text.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	html, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = html.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}
@@ -0,0 +1,44 @@
+package media
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound   = errors.New("media: object not found")
+	ErrInvalidKey = errors.New("media: invalid key")
+)
+
+// Object is a stored file being read back. Body is an io.ReadSeeker when the
+// backend supports it, which lets callers serve range requests.
+type Object struct {
+	Body        io.ReadCloser
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// MediaStore stores uploaded media under slash separated keys such as
+// "listings/<uuid>.webp".
+type MediaStore interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	// Stat returns the object without a Body.
+	Stat(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// cleanKey normalises key and rejects keys that would escape the store, such as
+// "../secrets".
+func cleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if cleaned == "/" || strings.Contains(key, "\x00") {
+		return "", ErrInvalidKey
+	}
+	return strings.TrimPrefix(cleaned, "/"), nil
+}
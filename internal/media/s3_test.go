@@ -0,0 +1,338 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testAccessKey = "minioadmin"
+	testSecretKey = "minioadmin-secret"
+	testRegion    = "us-east-1"
+	testBucket    = "media"
+)
+
+type storedObject struct {
+	body        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// s3StandIn is a minimal in-memory S3 that, like MinIO, checks the Signature
+// Version 4 of every request against what arrived on the wire.
+type s3StandIn struct {
+	mu      sync.Mutex
+	objects map[string]storedObject
+}
+
+func newS3StandIn(t *testing.T) (*s3StandIn, *httptest.Server) {
+	s := &s3StandIn{objects: map[string]storedObject{}}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := verifySignature(r, body); err != nil {
+		http.Error(w, "SignatureDoesNotMatch: "+err.Error(), http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + testBucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = storedObject{
+			body:        body,
+			contentType: r.Header.Get("Content-Type"),
+			modTime:     time.Now().UTC().Truncate(time.Second),
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj.body)))
+		w.Header().Set("Last-Modified", obj.modTime.Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.body)
+		}
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature recomputes the signature of r from the request as received,
+// independently of S3Store.sign.
+func verifySignature(r *http.Request, body []byte) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return errors.New("missing AWS4-HMAC-SHA256 authorization")
+	}
+
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		name, value, _ := strings.Cut(part, "=")
+		fields[name] = value
+	}
+
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[0] != testAccessKey || credential[2] != testRegion ||
+		credential[3] != "s3" || credential[4] != "aws4_request" {
+		return fmt.Errorf("bad credential %q", fields["Credential"])
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	signedAt, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil || time.Since(signedAt).Abs() > 15*time.Minute {
+		return fmt.Errorf("bad x-amz-date %q", amzDate)
+	}
+	if credential[1] != signedAt.Format("20060102") {
+		return errors.New("credential date does not match x-amz-date")
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	sum := sha256.Sum256(body)
+	if payloadHash != hex.EncodeToString(sum[:]) {
+		return errors.New("x-amz-content-sha256 does not match the body")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(fields["SignedHeaders"], ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	// Like S3, rebuild the canonical URI from the decoded path rather than trusting
+	// the client's encoding.
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" +
+		strings.Join(credential[1:], "/") + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + testSecretKey)
+	for _, part := range append(credential[1:], stringToSign) {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+
+	if fields["Signature"] != hex.EncodeToString(key) {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+// uriEncode encodes everything but RFC 3986 unreserved characters and slashes.
+func uriEncode(p string) string {
+	const unreserved = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_.~/"
+
+	var b strings.Builder
+	for _, c := range []byte(p) {
+		if strings.IndexByte(unreserved, c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+func newTestS3Store(t *testing.T, endpoint, secretKey string) *S3Store {
+	store, err := NewS3Store(S3Config{
+		Endpoint:  endpoint,
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: secretKey,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	standIn, srv := newS3StandIn(t)
+	store := newTestS3Store(t, srv.URL, testSecretKey)
+	ctx := context.Background()
+
+	keys := []string{
+		"listings/0b6f0ad6-3c3b-4bb5-9a43-3d4c1e2a7f10.webp",
+		"user-profile/with space+plus(ü).webp",
+	}
+
+	for _, key := range keys {
+		t.Run(key, func(t *testing.T) {
+			content := []byte("webp bytes for " + key)
+
+			err := store.Put(ctx, key, bytes.NewReader(content), "image/webp")
+			if err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+
+			standIn.mu.Lock()
+			_, stored := standIn.objects[key]
+			standIn.mu.Unlock()
+			if !stored {
+				t.Fatalf("object not stored under %q", key)
+			}
+
+			stat, err := store.Stat(ctx, key)
+			if err != nil {
+				t.Fatalf("Stat: %v", err)
+			}
+			if stat.Body != nil {
+				t.Error("Stat returned a body")
+			}
+			if stat.Size != int64(len(content)) {
+				t.Errorf("Stat size = %d, want %d", stat.Size, len(content))
+			}
+			if stat.ModTime.IsZero() {
+				t.Error("Stat did not return a modification time")
+			}
+
+			obj, err := store.Get(ctx, key)
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			got, err := io.ReadAll(obj.Body)
+			obj.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("Get body = %q, want %q", got, content)
+			}
+			if obj.ContentType != "image/webp" {
+				t.Errorf("Get content type = %q, want image/webp", obj.ContentType)
+			}
+			if obj.Size != int64(len(content)) {
+				t.Errorf("Get size = %d, want %d", obj.Size, len(content))
+			}
+
+			err = store.Delete(ctx, key)
+			if err != nil {
+				t.Fatalf("Delete: %v", err)
+			}
+
+			_, err = store.Get(ctx, key)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+			}
+
+			_, err = store.Stat(ctx, key)
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("Stat after Delete: got %v, want ErrNotFound", err)
+			}
+
+			// S3 deletes are idempotent.
+			err = store.Delete(ctx, key)
+			if err != nil {
+				t.Errorf("Delete of a missing object: %v", err)
+			}
+		})
+	}
+}
+
+func TestS3StoreWrongSecret(t *testing.T) {
+	_, srv := newS3StandIn(t)
+	store := newTestS3Store(t, srv.URL, "not-the-secret")
+	ctx := context.Background()
+
+	err := store.Put(ctx, "listings/a.webp", strings.NewReader("x"), "image/webp")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put with a wrong secret: got %v, want a 403 error", err)
+	}
+
+	_, err = store.Get(ctx, "listings/a.webp")
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("Get with a wrong secret: got %v, want a non-ErrNotFound error", err)
+	}
+
+	err = store.Delete(ctx, "listings/a.webp")
+	if err == nil {
+		t.Error("Delete with a wrong secret succeeded")
+	}
+}
+
+func TestS3StoreInvalidKey(t *testing.T) {
+	_, srv := newS3StandIn(t)
+	store := newTestS3Store(t, srv.URL, testSecretKey)
+
+	for _, key := range []string{"", "/", "a\x00b"} {
+		err := store.Put(context.Background(), key, strings.NewReader("x"), "")
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
+
+func TestS3StoreObjectURL(t *testing.T) {
+	tests := []struct {
+		pathStyle bool
+		endpoint  string
+		want      string
+	}{
+		{true, "http://localhost:9000", "http://localhost:9000/media/listings/a%20b.webp"},
+		{false, "https://s3.eu-central-1.amazonaws.com", "https://media.s3.eu-central-1.amazonaws.com/listings/a%20b.webp"},
+	}
+
+	for _, tt := range tests {
+		store, err := NewS3Store(S3Config{Endpoint: tt.endpoint, Bucket: testBucket, PathStyle: tt.pathStyle})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := store.objectURL("listings/a b.webp").String()
+		if got != tt.want {
+			t.Errorf("objectURL with PathStyle=%v = %q, want %q", tt.pathStyle, got, tt.want)
+		}
+	}
+}
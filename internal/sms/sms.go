@@ -0,0 +1,28 @@
+// Package sms delivers text messages such as one-time verification codes.
+package sms
+
+import (
+	"ghostprotocols.pk/internal/jsonlog"
+)
+
+// SMSSender sends message to the phone number to.
+type SMSSender interface {
+	Send(to, message string) error
+}
+
+// LogSender logs messages instead of sending them, for development and tests.
+type LogSender struct {
+	logger *jsonlog.Logger
+}
+
+func NewLog(logger *jsonlog.Logger) *LogSender {
+	return &LogSender{logger: logger}
+}
+
+func (s *LogSender) Send(to, message string) error {
+	s.logger.PrintInfo("sms", map[string]string{
+		"to":      to,
+		"message": message,
+	})
+	return nil
+}
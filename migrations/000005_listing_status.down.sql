@@ -0,0 +1,11 @@
+-- DROP TRIGGER
+DROP TRIGGER IF EXISTS refund_listing_limit_on_remove ON listings;
+
+-- DROP FUNCTION
+DROP FUNCTION IF EXISTS refund_listing_limit_on_remove();
+
+-- DROP INDEXES
+DROP INDEX IF EXISTS idx_listings_status;
+
+-- DROP COLUMNS
+ALTER TABLE listings DROP COLUMN IF EXISTS status;
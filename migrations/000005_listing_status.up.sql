@@ -0,0 +1,34 @@
+-- LISTING STATUS
+ALTER TABLE listings
+ADD COLUMN status TEXT NOT NULL DEFAULT 'active'
+    CHECK (status IN ('draft', 'active', 'sold', 'expired', 'removed'));
+
+UPDATE listings SET status = 'draft' WHERE active = false;
+
+CREATE INDEX idx_listings_status ON listings(status);
+
+-- TRIGGER FUNCTION to refund listing_limit when a listing is removed within the grace window.
+-- The grace window is read from the ghost.refund_grace setting, which the application sets
+-- per transaction. When it is not set no refund is given.
+CREATE OR REPLACE FUNCTION refund_listing_limit_on_remove()
+RETURNS TRIGGER AS $$
+DECLARE
+    grace INTERVAL;
+BEGIN
+    IF NEW.status = 'removed' AND OLD.status <> 'removed' THEN
+        grace := COALESCE(NULLIF(current_setting('ghost.refund_grace', true), ''), '0 seconds')::INTERVAL;
+
+        IF NOW() - OLD.created_at <= grace THEN
+            UPDATE users SET listing_limit = listing_limit + 1 WHERE id = NEW.seller;
+        END IF;
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- TRIGGER to refund listing_limit on remove
+CREATE TRIGGER refund_listing_limit_on_remove
+AFTER UPDATE OF status ON listings
+FOR EACH ROW
+EXECUTE FUNCTION refund_listing_limit_on_remove();
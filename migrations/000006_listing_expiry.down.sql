@@ -0,0 +1,15 @@
+-- DROP TRIGGER
+DROP TRIGGER IF EXISTS set_listing_expires_at ON listings;
+
+-- DROP FUNCTIONS
+DROP FUNCTION IF EXISTS set_listing_expires_at();
+DROP FUNCTION IF EXISTS listing_duration(INT);
+
+-- DROP INDEXES
+DROP INDEX IF EXISTS idx_listings_expires_at;
+DROP INDEX IF EXISTS idx_users_plan;
+
+-- DROP COLUMNS
+ALTER TABLE listings DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE users DROP COLUMN IF EXISTS plan;
+ALTER TABLE listing_plans DROP COLUMN IF EXISTS listing_days;
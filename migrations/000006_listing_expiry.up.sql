@@ -0,0 +1,40 @@
+-- LISTING PLANS duration
+ALTER TABLE listing_plans ADD COLUMN listing_days INT NOT NULL DEFAULT 30 CHECK (listing_days > 0);
+
+-- USERS plan
+ALTER TABLE users ADD COLUMN plan INT REFERENCES listing_plans(id);
+
+CREATE INDEX idx_users_plan ON users(plan);
+
+-- LISTINGS expiry
+ALTER TABLE listings ADD COLUMN expires_at TIMESTAMP;
+
+UPDATE listings SET expires_at = updated_at + INTERVAL '30 days';
+
+ALTER TABLE listings ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX idx_listings_expires_at ON listings(expires_at);
+
+-- FUNCTION returning how long a seller's listings stay up, 30 days without a plan
+CREATE OR REPLACE FUNCTION listing_duration(seller_id INT)
+RETURNS INTERVAL AS $$
+    SELECT make_interval(days => COALESCE(
+        (SELECT p.listing_days FROM users u JOIN listing_plans p ON u.plan = p.id WHERE u.id = seller_id),
+        30
+    ));
+$$ LANGUAGE sql STABLE;
+
+-- TRIGGER FUNCTION to set expires_at on insert
+CREATE OR REPLACE FUNCTION set_listing_expires_at()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.expires_at = NOW() + listing_duration(NEW.seller);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- TRIGGER to set expires_at on insert
+CREATE TRIGGER set_listing_expires_at
+BEFORE INSERT ON listings
+FOR EACH ROW
+EXECUTE FUNCTION set_listing_expires_at();
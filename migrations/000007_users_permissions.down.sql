@@ -0,0 +1,9 @@
+-- DROP INDEXES
+DROP INDEX IF EXISTS idx_users_permissions_permission_id;
+DROP INDEX IF EXISTS idx_permissions_code_unique;
+
+-- DROP TABLES
+DROP TABLE IF EXISTS users_permissions;
+
+-- DELETE SEEDED PERMISSIONS
+DELETE FROM permissions WHERE code IN ('catalog:write', 'listings:manage');
@@ -0,0 +1,15 @@
+-- PERMISSIONS unique codes
+CREATE UNIQUE INDEX idx_permissions_code_unique ON permissions(code);
+
+INSERT INTO permissions (code)
+VALUES ('catalog:write'), ('listings:manage')
+ON CONFLICT DO NOTHING;
+
+-- USERS PERMISSIONS table definition
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    permission_id INT NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+CREATE INDEX idx_users_permissions_permission_id ON users_permissions(permission_id);
@@ -0,0 +1,28 @@
+-- DROP TRIGGERS
+DROP TRIGGER IF EXISTS touch_version_on_details_change ON data_details;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_colors;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_versions;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_generations;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_models;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_makes;
+
+-- DROP FUNCTIONS
+DROP FUNCTION IF EXISTS touch_version_on_details_change();
+DROP FUNCTION IF EXISTS stamp_catalog_change();
+
+-- DROP INDEXES
+DROP INDEX IF EXISTS idx_data_colors_change_seq;
+DROP INDEX IF EXISTS idx_data_versions_change_seq;
+DROP INDEX IF EXISTS idx_data_generations_change_seq;
+DROP INDEX IF EXISTS idx_data_models_change_seq;
+DROP INDEX IF EXISTS idx_data_makes_change_seq;
+
+-- DROP COLUMNS
+ALTER TABLE data_colors DROP COLUMN IF EXISTS change_seq, DROP COLUMN IF EXISTS deleted, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE data_versions DROP COLUMN IF EXISTS change_seq, DROP COLUMN IF EXISTS deleted, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE data_generations DROP COLUMN IF EXISTS change_seq, DROP COLUMN IF EXISTS deleted, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE data_models DROP COLUMN IF EXISTS change_seq, DROP COLUMN IF EXISTS deleted, DROP COLUMN IF EXISTS updated_at;
+ALTER TABLE data_makes DROP COLUMN IF EXISTS change_seq, DROP COLUMN IF EXISTS deleted, DROP COLUMN IF EXISTS updated_at;
+
+-- DROP SEQUENCE
+DROP SEQUENCE IF EXISTS catalog_change_seq;
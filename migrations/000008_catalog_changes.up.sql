@@ -0,0 +1,75 @@
+-- CATALOG CHANGE SEQUENCE
+-- Every insert or update of a tracked catalog row takes the next value from this
+-- sequence, which clients use as their sync cursor.
+CREATE SEQUENCE IF NOT EXISTS catalog_change_seq;
+
+ALTER TABLE data_makes
+ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN change_seq BIGINT NOT NULL DEFAULT nextval('catalog_change_seq');
+
+ALTER TABLE data_models
+ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN change_seq BIGINT NOT NULL DEFAULT nextval('catalog_change_seq');
+
+ALTER TABLE data_generations
+ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN change_seq BIGINT NOT NULL DEFAULT nextval('catalog_change_seq');
+
+ALTER TABLE data_versions
+ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN change_seq BIGINT NOT NULL DEFAULT nextval('catalog_change_seq');
+
+ALTER TABLE data_colors
+ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN change_seq BIGINT NOT NULL DEFAULT nextval('catalog_change_seq');
+
+CREATE INDEX idx_data_makes_change_seq ON data_makes (change_seq);
+CREATE INDEX idx_data_models_change_seq ON data_models (change_seq);
+CREATE INDEX idx_data_generations_change_seq ON data_generations (change_seq);
+CREATE INDEX idx_data_versions_change_seq ON data_versions (change_seq);
+CREATE INDEX idx_data_colors_change_seq ON data_colors (change_seq);
+
+-- TRIGGER FUNCTION to stamp catalog rows on update
+CREATE OR REPLACE FUNCTION stamp_catalog_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    NEW.change_seq = nextval('catalog_change_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_makes
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_models
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_generations
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_versions
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_colors
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+-- TRIGGER FUNCTION to mark a version as changed when its details change, since the
+-- details are served as part of the version
+CREATE OR REPLACE FUNCTION touch_version_on_details_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    UPDATE data_versions SET updated_at = NOW() WHERE id = NEW.version_id;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER touch_version_on_details_change
+AFTER INSERT OR UPDATE ON data_details
+FOR EACH ROW
+EXECUTE FUNCTION touch_version_on_details_change();
@@ -0,0 +1,8 @@
+-- DROP INDEXES
+DROP INDEX IF EXISTS idx_data_versions_model_id_url_slug_unique;
+DROP INDEX IF EXISTS idx_data_generations_model_id_url_slug_unique;
+DROP INDEX IF EXISTS idx_data_models_make_id_url_slug_unique;
+DROP INDEX IF EXISTS idx_data_makes_url_slug_unique;
+
+-- DROP COLUMNS
+ALTER TABLE data_generations DROP COLUMN IF EXISTS published;
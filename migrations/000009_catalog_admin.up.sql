@@ -0,0 +1,8 @@
+-- GENERATIONS publishing
+ALTER TABLE data_generations ADD COLUMN published BOOLEAN DEFAULT true;
+
+-- UNIQUE SLUGS
+CREATE UNIQUE INDEX idx_data_makes_url_slug_unique ON data_makes (url_slug);
+CREATE UNIQUE INDEX idx_data_models_make_id_url_slug_unique ON data_models (make_id, url_slug);
+CREATE UNIQUE INDEX idx_data_generations_model_id_url_slug_unique ON data_generations (model_id, url_slug);
+CREATE UNIQUE INDEX idx_data_versions_model_id_url_slug_unique ON data_versions (model_id, url_slug);
@@ -0,0 +1,2 @@
+-- DROP COLUMNS
+ALTER TABLE data_colors DROP COLUMN IF EXISTS pk_id;
@@ -0,0 +1,2 @@
+-- COLORS external identifier
+ALTER TABLE data_colors ADD COLUMN pk_id INT UNIQUE;
@@ -0,0 +1,11 @@
+-- DROP TRIGGERS
+DROP TRIGGER IF EXISTS claim_profile_upload ON users;
+DROP TRIGGER IF EXISTS claim_gallery_uploads ON listings;
+
+-- DROP FUNCTIONS
+DROP FUNCTION IF EXISTS claim_profile_upload();
+DROP FUNCTION IF EXISTS claim_gallery_uploads();
+DROP FUNCTION IF EXISTS gallery_upload_ids(JSON);
+
+-- DROP TABLES
+DROP TABLE IF EXISTS media_uploads;
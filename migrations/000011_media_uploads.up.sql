@@ -0,0 +1,86 @@
+-- MEDIA UPLOADS
+-- Every stored upload is recorded here so that files nothing references can be swept.
+-- Gallery uploads start out pending and are claimed once a listing's gallery points at
+-- them. Profile pictures are claimed when set on a user and marked replaced when the
+-- user picks another one.
+CREATE TABLE IF NOT EXISTS media_uploads (
+    id UUID PRIMARY KEY,
+    owner_id INT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('gallery', 'profile')),
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'claimed', 'replaced', 'deleting')),
+    listing_id INT REFERENCES listings(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_media_uploads_owner_id ON media_uploads(owner_id);
+CREATE INDEX idx_media_uploads_listing_id ON media_uploads(listing_id);
+CREATE INDEX idx_media_uploads_status_updated_at ON media_uploads(status, updated_at);
+
+-- FUNCTION returning the upload ids referenced by a listing gallery
+CREATE OR REPLACE FUNCTION gallery_upload_ids(gallery JSON)
+RETURNS TEXT[] AS $$
+    SELECT COALESCE(array_agg(split_part(image->>'url', '.', 1)), '{}')
+    FROM json_array_elements(COALESCE(gallery, '[]'::JSON)) AS image;
+$$ LANGUAGE sql IMMUTABLE;
+
+-- TRIGGER FUNCTION to claim the seller's uploads a gallery references and release the
+-- ones it no longer does
+CREATE OR REPLACE FUNCTION claim_gallery_uploads()
+RETURNS TRIGGER AS $$
+DECLARE
+    ids TEXT[] := gallery_upload_ids(NEW.gallery);
+BEGIN
+    UPDATE media_uploads
+    SET status = 'claimed', listing_id = NEW.id, updated_at = NOW()
+    WHERE kind = 'gallery' AND owner_id = NEW.seller AND status = 'pending'
+    AND id::TEXT = ANY(ids);
+
+    IF TG_OP = 'UPDATE' THEN
+        UPDATE media_uploads
+        SET status = 'pending', listing_id = NULL, updated_at = NOW()
+        WHERE kind = 'gallery' AND listing_id = NEW.id AND status = 'claimed'
+        AND NOT id::TEXT = ANY(ids);
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- TRIGGER to claim gallery uploads when a listing is created or its gallery changes
+CREATE TRIGGER claim_gallery_uploads
+AFTER INSERT OR UPDATE OF gallery ON listings
+FOR EACH ROW
+EXECUTE FUNCTION claim_gallery_uploads();
+
+-- TRIGGER FUNCTION to claim a new profile picture and mark the previous one replaced.
+-- Pictures uploaded before uploads were tracked get a row so they are swept as well.
+CREATE OR REPLACE FUNCTION claim_profile_upload()
+RETURNS TRIGGER AS $$
+DECLARE
+    uuid_rx CONSTANT TEXT := '^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$';
+    old_id TEXT := split_part(COALESCE(OLD.profile_pic, ''), '.', 1);
+    new_id TEXT := split_part(COALESCE(NEW.profile_pic, ''), '.', 1);
+BEGIN
+    IF new_id ~ uuid_rx THEN
+        UPDATE media_uploads
+        SET status = 'claimed', updated_at = NOW()
+        WHERE id = new_id::UUID AND owner_id = NEW.id AND kind = 'profile';
+    END IF;
+
+    IF old_id ~ uuid_rx AND old_id IS DISTINCT FROM new_id THEN
+        INSERT INTO media_uploads (id, owner_id, kind, status)
+        VALUES (old_id::UUID, NEW.id, 'profile', 'replaced')
+        ON CONFLICT (id) DO UPDATE SET status = 'replaced', updated_at = NOW();
+    END IF;
+
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+-- TRIGGER to track profile picture changes
+CREATE TRIGGER claim_profile_upload
+AFTER UPDATE OF profile_pic ON users
+FOR EACH ROW
+EXECUTE FUNCTION claim_profile_upload();
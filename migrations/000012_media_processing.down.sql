@@ -0,0 +1,4 @@
+-- DROP COLUMNS
+ALTER TABLE media_uploads DROP COLUMN IF EXISTS height;
+ALTER TABLE media_uploads DROP COLUMN IF EXISTS width;
+ALTER TABLE media_uploads DROP COLUMN IF EXISTS processing;
@@ -0,0 +1,8 @@
+-- MEDIA UPLOADS processing state
+-- Gallery uploads are resized and encoded by background workers. Uploads stored
+-- before that are already processed.
+ALTER TABLE media_uploads
+ADD COLUMN processing TEXT NOT NULL DEFAULT 'ready'
+    CHECK (processing IN ('pending', 'ready', 'failed')),
+ADD COLUMN width INT,
+ADD COLUMN height INT;
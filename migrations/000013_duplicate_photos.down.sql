@@ -0,0 +1,8 @@
+-- DROP TABLES
+DROP TABLE IF EXISTS duplicate_photos;
+
+-- DROP FUNCTIONS
+DROP FUNCTION IF EXISTS hamming_distance(BIGINT, BIGINT);
+
+-- DROP COLUMNS
+ALTER TABLE media_uploads DROP COLUMN IF EXISTS dhash;
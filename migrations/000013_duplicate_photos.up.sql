@@ -0,0 +1,26 @@
+-- MEDIA UPLOADS perceptual hash
+ALTER TABLE media_uploads ADD COLUMN dhash BIGINT;
+
+CREATE INDEX idx_media_uploads_dhash ON media_uploads(dhash) WHERE dhash IS NOT NULL;
+
+-- FUNCTION counting the bits that differ between two hashes
+CREATE OR REPLACE FUNCTION hamming_distance(a BIGINT, b BIGINT)
+RETURNS INT AS $$
+    SELECT length(replace((a # b)::BIT(64)::TEXT, '0', ''));
+$$ LANGUAGE sql IMMUTABLE STRICT;
+
+-- DUPLICATE PHOTOS flagged for moderation. A row records that an image of a listing
+-- looks like an image already used on another seller's listing.
+CREATE TABLE IF NOT EXISTS duplicate_photos (
+    id SERIAL PRIMARY KEY,
+    listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    upload_id UUID NOT NULL REFERENCES media_uploads(id) ON DELETE CASCADE,
+    matched_listing_id INT NOT NULL REFERENCES listings(id) ON DELETE CASCADE,
+    matched_upload_id UUID NOT NULL REFERENCES media_uploads(id) ON DELETE CASCADE,
+    distance INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (upload_id, matched_upload_id)
+);
+
+CREATE INDEX idx_duplicate_photos_listing_id ON duplicate_photos(listing_id);
+CREATE INDEX idx_duplicate_photos_created_at ON duplicate_photos(created_at);
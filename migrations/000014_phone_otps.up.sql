@@ -0,0 +1,15 @@
+-- PHONE OTPS table definition
+-- One outstanding code per user. sends counts the codes sent since window_start so
+-- that the number of texts a user can trigger is capped.
+CREATE TABLE IF NOT EXISTS phone_otps (
+    user_id INT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    phone TEXT NOT NULL,
+    code_hash BYTEA NOT NULL,
+    expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    sent_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sends INT NOT NULL DEFAULT 1,
+    window_start TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_phone_otps_expiry ON phone_otps(expiry);
@@ -0,0 +1,9 @@
+-- TOKENS session details
+-- Authentication tokens double as sessions that users can list and revoke, so they
+-- get a stable ID and record where they were last used from.
+ALTER TABLE tokens
+ADD COLUMN id BIGSERIAL UNIQUE,
+ADD COLUMN created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+ADD COLUMN last_used TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN ip TEXT NOT NULL DEFAULT '',
+ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+-- DROP INDEXES
+DROP INDEX IF EXISTS idx_tokens_family_id;
+
+-- DROP TOKENS
+DELETE FROM tokens WHERE scope = 'refresh';
+
+-- DROP COLUMNS
+ALTER TABLE tokens DROP COLUMN IF EXISTS rotated;
+ALTER TABLE tokens DROP COLUMN IF EXISTS family_id;
+
+-- DROP SEQUENCES
+DROP SEQUENCE IF EXISTS token_families_seq;
@@ -0,0 +1,14 @@
+-- TOKENS families
+-- Each sign in starts a family of access and refresh tokens. Rotating a refresh
+-- token marks it rotated instead of deleting it, so that a copied refresh token is
+-- recognised when it is presented again and the family can be revoked.
+CREATE SEQUENCE IF NOT EXISTS token_families_seq;
+
+ALTER TABLE tokens
+ADD COLUMN family_id BIGINT,
+ADD COLUMN rotated BOOLEAN NOT NULL DEFAULT false;
+
+-- Existing authentication tokens become sessions of their own.
+UPDATE tokens SET family_id = nextval('token_families_seq') WHERE scope = 'authentication';
+
+CREATE INDEX idx_tokens_family_id ON tokens(family_id);
@@ -0,0 +1,2 @@
+-- DROP TABLES
+DROP TABLE IF EXISTS login_attempts;
@@ -0,0 +1,9 @@
+-- LOGIN ATTEMPTS table definition
+-- Failed sign ins per identifier, whether or not an account uses it. Once an
+-- identifier has failed too often it is blocked until blocked_until.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    identifier TEXT PRIMARY KEY,
+    failures INT NOT NULL DEFAULT 0,
+    last_failure TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    blocked_until TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
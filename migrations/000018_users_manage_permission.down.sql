@@ -0,0 +1,2 @@
+-- DROP PERMISSIONS
+DELETE FROM permissions WHERE code = 'users:manage';
@@ -0,0 +1,8 @@
+-- PERMISSIONS users:manage
+-- Lets a user grant and revoke permissions through the API. The first holder has to
+-- be granted it directly, e.g.:
+--   INSERT INTO users_permissions
+--   SELECT <user id>, id FROM permissions WHERE code = 'users:manage';
+INSERT INTO permissions (code)
+VALUES ('users:manage')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,30 @@
+-- RESTORE TRIGGERS
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_makes;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_models;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_generations;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_versions;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_colors;
+
+CREATE OR REPLACE FUNCTION stamp_catalog_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = NOW();
+    NEW.change_seq = nextval('catalog_change_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_makes
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_models
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_generations
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_versions
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE UPDATE ON data_colors
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
@@ -0,0 +1,36 @@
+-- TRIGGER FUNCTION to stamp catalog rows on insert and update
+-- Sequence values are handed out when a row is written but only become visible when
+-- the transaction commits, so a transaction could otherwise commit a change below a
+-- cursor a client has already synced past. Holding a transaction lock from the first
+-- stamped row until commit makes catalog writers take their change_seq values in
+-- commit order.
+CREATE OR REPLACE FUNCTION stamp_catalog_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    PERFORM pg_advisory_xact_lock(hashtext('catalog_change_seq'));
+    NEW.updated_at = NOW();
+    NEW.change_seq = nextval('catalog_change_seq');
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_makes;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_models;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_generations;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_versions;
+DROP TRIGGER IF EXISTS stamp_catalog_change ON data_colors;
+
+CREATE TRIGGER stamp_catalog_change BEFORE INSERT OR UPDATE ON data_makes
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE INSERT OR UPDATE ON data_models
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE INSERT OR UPDATE ON data_generations
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE INSERT OR UPDATE ON data_versions
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
+
+CREATE TRIGGER stamp_catalog_change BEFORE INSERT OR UPDATE ON data_colors
+FOR EACH ROW EXECUTE FUNCTION stamp_catalog_change();
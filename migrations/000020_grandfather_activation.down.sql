@@ -0,0 +1,2 @@
+-- DROP COLUMNS
+ALTER TABLE users DROP COLUMN IF EXISTS grandfathered_at;
@@ -0,0 +1,7 @@
+-- USERS activation
+-- Accounts created before activation emails were sent never got a token, so they
+-- count as activated rather than being locked out of creating listings. Their
+-- email_verified flag is left alone, as it is shown to buyers.
+ALTER TABLE users ADD COLUMN grandfathered_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE users SET grandfathered_at = NOW() WHERE email_verified IS NOT TRUE;
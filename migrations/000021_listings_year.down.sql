@@ -0,0 +1,4 @@
+-- RESTORE CONSTRAINTS
+-- NOT VALID keeps listings from 2025 onwards that were created in the meantime.
+ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_year_check;
+ALTER TABLE listings ADD CONSTRAINT listings_year_check CHECK (year > 1940 AND year < 2025) NOT VALID;
@@ -0,0 +1,5 @@
+-- LISTINGS year
+-- The original check stopped at 2024. Listings are validated against the current
+-- year, so the database only keeps a sanity bound.
+ALTER TABLE listings DROP CONSTRAINT IF EXISTS listings_year_check;
+ALTER TABLE listings ADD CONSTRAINT listings_year_check CHECK (year > 1940 AND year < 2100);